@@ -0,0 +1,328 @@
+package adminHandlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/middlewares"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/loginThrottleService"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/operationService"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/rateLimitService"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/userService"
+)
+
+func operationIDFromQuery(r *http.Request) (int64, error) {
+	operationIDStr := r.URL.Query().Get("operation_id")
+	if operationIDStr == "" {
+		return 0, errors.New("Operation ID is required")
+	}
+	operationID, err := strconv.ParseInt(operationIDStr, 10, 64)
+	if err != nil {
+		return 0, errors.New("Invalid operation ID")
+	}
+	return operationID, nil
+}
+
+func userIDFromQuery(r *http.Request) (int64, error) {
+	userIDStr := r.URL.Query().Get("user_id")
+	if userIDStr == "" {
+		return 0, errors.New("User ID is required")
+	}
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return 0, errors.New("Invalid user ID")
+	}
+	return userID, nil
+}
+
+func sendCatalogError(w http.ResponseWriter, err error) {
+	var invalid operationService.ErrInvalidCatalogEntry
+	switch {
+	case errors.As(err, &invalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, models.ErrOperationNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, models.ErrOperationExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("Error updating operations catalog: %v", err)
+		http.Error(w, "Failed to update operations catalog", http.StatusInternalServerError)
+	}
+}
+
+func HandleOperations(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminID, err := middlewares.CurrentUserID(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			operations, err := operationService.GetCatalog(db)
+			if err != nil {
+				log.Printf("Error retrieving operations: %v", err)
+				http.Error(w, "Failed to retrieve operations", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{"operations": operations})
+
+		case http.MethodPost:
+			var requestBody struct {
+				Type   string       `json:"type"`
+				Cost   models.Money `json:"cost"`
+				Status string       `json:"status"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			if requestBody.Status == "" {
+				requestBody.Status = models.StatusActive
+			}
+
+			operation, err := operationService.CreateCatalogOperation(db, adminID, requestBody.Type, requestBody.Cost, requestBody.Status)
+			if err != nil {
+				sendCatalogError(w, err)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(operation)
+
+		case http.MethodPut:
+			operationID, err := operationIDFromQuery(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			var requestBody struct {
+				Cost   *models.Money `json:"cost"`
+				Status *string       `json:"status"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+
+			operation, err := operationService.UpdateCatalogOperation(db, adminID, operationID, requestBody.Cost, requestBody.Status)
+			if err != nil {
+				sendCatalogError(w, err)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(operation)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func GetOperationPriceHistory(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		operationID, err := operationIDFromQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		history, err := operationService.GetPriceHistory(db, operationID)
+		if err != nil {
+			log.Printf("Error retrieving price history: %v", err)
+			http.Error(w, "Failed to retrieve price history", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"price_history": history})
+	}
+}
+
+func HandleUserRoles(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := userIDFromQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var roles []string
+		switch r.Method {
+		case http.MethodGet:
+			roles, err = userService.GetUserRoles(db, userID)
+		case http.MethodPut:
+			var requestBody struct {
+				Roles []string `json:"roles"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			roles, err = userService.SetUserRoles(db, userID, requestBody.Roles)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err != nil {
+			if errors.Is(err, models.ErrUserNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if r.Method == http.MethodPut {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Printf("Error retrieving user roles: %v", err)
+			http.Error(w, "Failed to retrieve user roles", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"user_id": userID, "roles": roles})
+	}
+}
+
+func GrantCredits(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		adminID, err := middlewares.CurrentUserID(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var requestBody struct {
+			UserID  int64        `json:"user_id"`
+			Credits models.Money `json:"credits"`
+			Reason  string       `json:"reason"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		entry, err := userService.GrantCredits(db, adminID, requestBody.UserID, requestBody.Credits, requestBody.Reason)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrUserNotFound):
+				http.Error(w, err.Error(), http.StatusNotFound)
+			case errors.Is(err, models.ErrInsufficientCredits):
+				http.Error(w, err.Error(), http.StatusPaymentRequired)
+			default:
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entry)
+	}
+}
+
+// HandleLoginLockouts lists the usernames and addresses currently blocked
+// after failed logins (GET) or clears one of them (DELETE ?key=).
+func HandleLoginLockouts() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			lockouts, err := loginThrottleService.ListLockouts()
+			if err != nil {
+				http.Error(w, "Failed to load lockouts", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(lockouts)
+		case http.MethodDelete:
+			key := r.URL.Query().Get("key")
+			if key == "" {
+				http.Error(w, "Lockout key is required", http.StatusBadRequest)
+				return
+			}
+			if err := loginThrottleService.ClearLockout(key); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// HandleRateLimitOverrides lists (GET), sets (PUT) and removes
+// (DELETE &scope=) a user's rate limit overrides, selected with ?user_id=.
+func HandleRateLimitOverrides(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := userIDFromQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			adminID, err := middlewares.CurrentUserID(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			var override models.RateLimitOverride
+			if err := json.NewDecoder(r.Body).Decode(&override); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			override.UserID = userID
+			if err := rateLimitService.SetOverride(db, adminID, &override); err != nil {
+				sendOverrideError(w, err)
+				return
+			}
+		case http.MethodDelete:
+			if err := rateLimitService.DeleteOverride(db, userID, r.URL.Query().Get("scope")); err != nil {
+				sendOverrideError(w, err)
+				return
+			}
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		overrides, err := rateLimitService.GetOverrides(db, userID)
+		if err != nil {
+			log.Printf("Error retrieving rate limit overrides: %v", err)
+			http.Error(w, "Failed to retrieve rate limit overrides", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(overrides)
+	}
+}
+
+func sendOverrideError(w http.ResponseWriter, err error) {
+	var invalid rateLimitService.ErrInvalidOverride
+	switch {
+	case errors.As(err, &invalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, models.ErrUserNotFound), errors.Is(err, models.ErrOverrideNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		log.Printf("Error updating rate limit overrides: %v", err)
+		http.Error(w, "Failed to update rate limit overrides", http.StatusInternalServerError)
+	}
+}
@@ -1,13 +1,25 @@
 package authHandlers
 
 import (
+	"bytes"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"io"
+	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Ignacio-J-Maylin/arithmetic-calculator/middlewares"
 	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/emailVerificationService"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/loginThrottleService"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/mailService"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/mfaService"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/passwordResetService"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/refreshTokenService"
 	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/userService"
 )
 
@@ -17,21 +29,49 @@ func decodeCredentials(r *http.Request) (models.Credentials, error) {
 	return creds, err
 }
 
-func generateTokens(userID int64, username string) (string, string, error) {
-	token, err := middlewares.GenerateJWT(userID, username)
+// tokenResponse builds the login/refresh payload, telling clients when each
+// token stops being usable so they can refresh ahead of time.
+func tokenResponse(token, refreshToken string, session *models.Session) map[string]interface{} {
+	return map[string]interface{}{
+		"token":              token,
+		"refresh_token":      refreshToken,
+		"expires_in":         int64(middlewares.AccessTokenLifetime() / time.Second),
+		"refresh_expires_in": int64(time.Until(session.IdleExpiresAt) / time.Second),
+	}
+}
+
+func generateTokens(db *sql.DB, userID int64, username string, roles []string) (map[string]interface{}, error) {
+	refreshToken, session, err := refreshTokenService.Issue(db, userID)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
-	refreshToken, err := middlewares.GenerateRefreshToken(userID, username)
+	token, err := middlewares.GenerateJWT(userID, username, roles, session.ID)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
-	return token, refreshToken, nil
+	response := tokenResponse(token, refreshToken, session)
+	response["username"] = username
+	return response, nil
+}
+
+// refreshTokenFromRequest reads the opaque refresh token from a JSON body
+// field "refresh_token", falling back to the Authorization header.
+func refreshTokenFromRequest(r *http.Request) string {
+	body, _ := io.ReadAll(r.Body)
+	if len(bytes.TrimSpace(body)) > 0 {
+		var requestBody struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		if err := json.Unmarshal(body, &requestBody); err == nil && requestBody.RefreshToken != "" {
+			return requestBody.RefreshToken
+		}
+	}
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
 }
 
-func sendJSONResponse(w http.ResponseWriter, status int, data map[string]string) {
+func sendJSONResponse(w http.ResponseWriter, status int, data map[string]interface{}) {
 	w.WriteHeader(status)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(data)
@@ -50,26 +90,78 @@ func SignUp(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		err = userService.RegisterUser(db, creds.Username, creds.Password)
+		userID, err := userService.RegisterUser(db, creds.Username, creds.Password)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusConflict)
 			return
 		}
 
-		token, refreshToken, err := generateTokens(0, creds.Username)
+		if err := emailVerificationService.SendVerification(db, userID); err != nil {
+			log.Printf("Error sending verification email to user %d: %v", userID, err)
+		}
+
+		response, err := generateTokens(db, userID, creds.Username, []string{models.RoleUser})
 		if err != nil {
 			http.Error(w, "Error generating token", http.StatusInternalServerError)
 			return
 		}
+		response["status"] = models.StatusPendingVerification
 
-		sendJSONResponse(w, http.StatusCreated, map[string]string{
-			"username":      creds.Username,
-			"token":         token,
-			"refresh_token": refreshToken,
-		})
+		sendJSONResponse(w, http.StatusCreated, response)
 	}
 }
 
+// allowLoginAttempt answers 429 with Retry-After, and audits the attempt,
+// while the username or address is blocked after failed logins.
+func allowLoginAttempt(w http.ResponseWriter, db *sql.DB, username, ip string) bool {
+	err := loginThrottleService.Check(username, ip)
+	if err == nil {
+		return true
+	}
+
+	var locked *loginThrottleService.LockedError
+	if !errors.As(err, &locked) {
+		http.Error(w, "Error checking login attempts", http.StatusInternalServerError)
+		return false
+	}
+	if err := loginThrottleService.RecordFailure(db, username, ip, models.LoginFailureLocked); err != nil {
+		log.Printf("Error recording failed login: %v", err)
+	}
+	seconds := int64((locked.RetryAfter + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	http.Error(w, "Too many failed login attempts", http.StatusTooManyRequests)
+	return false
+}
+
+func recordLoginFailure(db *sql.DB, username, ip string) {
+	if err := loginThrottleService.RecordFailure(db, username, ip, models.LoginFailureInvalidCredentials); err != nil {
+		log.Printf("Error recording failed login: %v", err)
+	}
+}
+
+// completeLogin clears the failed-login counter and answers with a fresh
+// access/refresh pair.
+func completeLogin(w http.ResponseWriter, db *sql.DB, user *models.User) {
+	if err := loginThrottleService.RecordSuccess(user.Username); err != nil {
+		log.Printf("Error clearing failed logins: %v", err)
+	}
+
+	roles, err := userService.GetUserRoles(db, user.ID)
+	if err != nil {
+		http.Error(w, "Error loading user roles", http.StatusInternalServerError)
+		return
+	}
+
+	response, err := generateTokens(db, user.ID, user.Username, roles)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+	response["status"] = user.Status
+
+	sendJSONResponse(w, http.StatusOK, response)
+}
+
 func Login(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		creds, err := decodeCredentials(r)
@@ -78,57 +170,293 @@ func Login(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		ip := middlewares.ClientIP(r)
+		if !allowLoginAttempt(w, db, creds.Username, ip) {
+			return
+		}
+
 		userID, isAuthenticated, err := userService.AuthenticateUser(db, creds.Username, creds.Password)
-		if err != nil || !isAuthenticated {
+		if err != nil {
+			if errors.Is(err, models.ErrAccountDisabled) {
+				http.Error(w, "Account is disabled", http.StatusForbidden)
+				return
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !isAuthenticated {
+			recordLoginFailure(db, creds.Username, ip)
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		token, refreshToken, err := generateTokens(userID, creds.Username)
+		user, err := userService.GetUserByID(db, userID)
 		if err != nil {
-			http.Error(w, "Error generating token", http.StatusInternalServerError)
+			http.Error(w, "Error loading user", http.StatusInternalServerError)
 			return
 		}
 
-		sendJSONResponse(w, http.StatusOK, map[string]string{
-			"username":      creds.Username,
-			"token":         token,
-			"refresh_token": refreshToken,
-		})
+		mfaEnabled, err := mfaService.IsEnabled(db, userID)
+		if err != nil {
+			http.Error(w, "Error loading two-factor settings", http.StatusInternalServerError)
+			return
+		}
+		if mfaEnabled {
+			// The failed-login counter is only cleared after the second
+			// step, so codes cannot be guessed by repeating the password.
+			challenge, err := mfaService.IssueChallenge(userID)
+			if err != nil {
+				http.Error(w, "Error generating token", http.StatusInternalServerError)
+				return
+			}
+			sendJSONResponse(w, http.StatusOK, map[string]interface{}{
+				"mfa_required": true,
+				"mfa_token":    challenge,
+				"expires_in":   int64(mfaService.ChallengeLifetime() / time.Second),
+			})
+			return
+		}
+
+		completeLogin(w, db, user)
 	}
 }
 
-func RefreshToken(db *sql.DB) http.HandlerFunc {
+// LoginMFA completes a login started with a password by checking a TOTP
+// code or a recovery code against the challenge token.
+func LoginMFA(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		refreshToken := strings.TrimPrefix(authHeader, "Bearer ")
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
 
+		var requestBody struct {
+			MFAToken     string `json:"mfa_token"`
+			Code         string `json:"code"`
+			RecoveryCode string `json:"recovery_code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || requestBody.MFAToken == "" ||
+			(requestBody.Code == "" && requestBody.RecoveryCode == "") {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := mfaService.ParseChallenge(requestBody.MFAToken)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		user, err := userService.GetUserByID(db, userID)
+		if err != nil || !user.CanAuthenticate() {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ip := middlewares.ClientIP(r)
+		if !allowLoginAttempt(w, db, user.Username, ip) {
+			return
+		}
+
+		if err := mfaService.Verify(db, userID, requestBody.Code, requestBody.RecoveryCode); err != nil {
+			if errors.Is(err, models.ErrInvalidMFACode) || errors.Is(err, models.ErrMFANotEnrolled) {
+				recordLoginFailure(db, user.Username, ip)
+				http.Error(w, models.ErrInvalidMFACode.Error(), http.StatusUnauthorized)
+				return
+			}
+			http.Error(w, "Error verifying code", http.StatusInternalServerError)
+			return
+		}
+
+		completeLogin(w, db, user)
+	}
+}
+
+func RefreshToken(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		refreshToken := refreshTokenFromRequest(r)
 		if refreshToken == "" {
 			http.Error(w, "No refresh token provided", http.StatusUnauthorized)
 			return
 		}
 
-		claims, err := middlewares.ValidateJWT(refreshToken)
+		session, newRefreshToken, err := refreshTokenService.Rotate(db, refreshToken)
 		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrRefreshTokenReused):
+				http.Error(w, "Refresh token reuse detected, please log in again", http.StatusUnauthorized)
+			case errors.Is(err, models.ErrInvalidRefreshToken):
+				http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			default:
+				http.Error(w, "Error generating new tokens", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		user, err := userService.GetUserByID(db, session.UserID)
+		if err != nil || !user.CanAuthenticate() {
 			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
 			return
 		}
 
-		newToken, newRefreshToken, err := generateTokens(claims.UserID, claims.Username)
+		roles, err := userService.GetUserRoles(db, user.ID)
+		if err != nil {
+			http.Error(w, "Error loading user roles", http.StatusInternalServerError)
+			return
+		}
+
+		newToken, err := middlewares.GenerateJWT(user.ID, user.Username, roles, session.ID)
 		if err != nil {
 			http.Error(w, "Error generating new tokens", http.StatusInternalServerError)
 			return
 		}
 
-		sendJSONResponse(w, http.StatusOK, map[string]string{
-			"token":         newToken,
-			"refresh_token": newRefreshToken,
+		sendJSONResponse(w, http.StatusOK, tokenResponse(newToken, newRefreshToken, session))
+	}
+}
+
+func Logout(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		refreshToken := refreshTokenFromRequest(r)
+		if refreshToken == "" {
+			http.Error(w, "No refresh token provided", http.StatusBadRequest)
+			return
+		}
+
+		if err := refreshTokenService.Revoke(db, refreshToken); err != nil && !errors.Is(err, models.ErrInvalidRefreshToken) {
+			http.Error(w, "Error logging out", http.StatusInternalServerError)
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, map[string]interface{}{"message": "Logout successful"})
+	}
+}
+
+func ForgotPassword(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var requestBody struct {
+			Email string `json:"email"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || requestBody.Email == "" {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		// The response is the same, and takes the same time, whether or not
+		// the address is registered or the email could be sent: the lookup
+		// and delivery happen on the reset queue after responding.
+		if err := passwordResetService.QueueReset(db, requestBody.Email); err != nil {
+			log.Printf("Dropping password reset request: %v", err)
+		}
+
+		sendJSONResponse(w, http.StatusAccepted, map[string]interface{}{
+			"message": "If the address is registered, a password reset link has been sent",
 		})
 	}
 }
 
-func Logout() http.HandlerFunc {
+func ResetPassword(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var requestBody struct {
+			Token    string `json:"token"`
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || requestBody.Token == "" {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		if err := passwordResetService.ResetPassword(db, requestBody.Token, requestBody.Password); err != nil {
+			switch {
+			case errors.Is(err, models.ErrPasswordTooShort), errors.Is(err, models.ErrInvalidResetToken):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			default:
+				http.Error(w, "Error resetting password", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, map[string]interface{}{"message": "Password has been reset, please log in again"})
+	}
+}
+
+func VerifyEmail(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var requestBody struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || requestBody.Token == "" {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		if err := emailVerificationService.Verify(db, requestBody.Token); err != nil {
+			if errors.Is(err, models.ErrInvalidVerification) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, "Error verifying email", http.StatusInternalServerError)
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, map[string]interface{}{"message": "Email verified", "status": models.StatusActive})
+	}
+}
+
+// ResendVerification emails a new verification link to the authenticated
+// user. Must run after AuthMiddleware.
+func ResendVerification(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := middlewares.CurrentUserID(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		if err := emailVerificationService.SendVerification(db, userID); err != nil {
+			var tooSoon *emailVerificationService.ResendTooSoonError
+			switch {
+			case errors.As(err, &tooSoon):
+				seconds := int64((tooSoon.RetryAfter + time.Second - 1) / time.Second)
+				w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+				http.Error(w, err.Error(), http.StatusTooManyRequests)
+			case errors.Is(err, models.ErrAlreadyVerified):
+				http.Error(w, err.Error(), http.StatusConflict)
+			case errors.Is(err, mailService.ErrQueueFull):
+				http.Error(w, "Verification email could not be queued, try again later", http.StatusServiceUnavailable)
+			default:
+				http.Error(w, "Error sending verification email", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		sendJSONResponse(w, http.StatusAccepted, map[string]interface{}{"message": "Verification email sent"})
+	}
+}
+
+func JWKS() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		sendJSONResponse(w, http.StatusOK, map[string]string{"message": "Logout successful"})
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(middlewares.Keys().JWKS())
 	}
 }
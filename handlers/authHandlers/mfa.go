@@ -0,0 +1,121 @@
+package authHandlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/middlewares"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/mfaService"
+)
+
+type mfaCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+func sendMFAError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrInvalidMFACode):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, models.ErrMFANotEnrolled), errors.Is(err, models.ErrMFAAlreadyEnabled):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "Error updating two-factor authentication", http.StatusInternalServerError)
+	}
+}
+
+// EnrollMFA creates a pending TOTP secret for the authenticated user and
+// returns it with the otpauth:// URI to render as a QR code.
+func EnrollMFA(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		principal, err := middlewares.CurrentPrincipal(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		secret, uri, err := mfaService.Enroll(db, principal.UserID, principal.Username)
+		if err != nil {
+			sendMFAError(w, err)
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, map[string]interface{}{
+			"secret":           secret,
+			"provisioning_uri": uri,
+		})
+	}
+}
+
+// ActivateMFA enables two-factor authentication after checking the first
+// code from the user's app and returns the recovery codes, once.
+func ActivateMFA(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := middlewares.CurrentUserID(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var requestBody mfaCodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || requestBody.Code == "" {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		codes, err := mfaService.Activate(db, userID, requestBody.Code)
+		if err != nil {
+			sendMFAError(w, err)
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, map[string]interface{}{
+			"message":        "Two-factor authentication enabled",
+			"recovery_codes": codes,
+		})
+	}
+}
+
+// DisableMFA turns two-factor authentication off; it requires a current
+// code or an unused recovery code.
+func DisableMFA(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := middlewares.CurrentUserID(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var requestBody mfaCodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil ||
+			(requestBody.Code == "" && requestBody.RecoveryCode == "") {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		if err := mfaService.Disable(db, userID, requestBody.Code, requestBody.RecoveryCode); err != nil {
+			sendMFAError(w, err)
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, map[string]interface{}{"message": "Two-factor authentication disabled"})
+	}
+}
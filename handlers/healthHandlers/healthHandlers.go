@@ -0,0 +1,51 @@
+package healthHandlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/outboundService"
+)
+
+const (
+	statusOK          = "ok"
+	statusDegraded    = "degraded"
+	statusUnavailable = "unavailable"
+)
+
+// Health reports whether the database is reachable and the circuit breaker
+// state and call counters of every outbound dependency. An open breaker
+// only degrades the service; an unreachable database makes it unavailable.
+func Health(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		status, code := statusOK, http.StatusOK
+		database := statusOK
+		if err := db.Ping(); err != nil {
+			log.Printf("Health check could not reach the database: %v", err)
+			database = statusUnavailable
+			status, code = statusUnavailable, http.StatusServiceUnavailable
+		}
+
+		dependencies := outboundService.Statuses()
+		for _, dependency := range dependencies {
+			if dependency.State != outboundService.StateClosed && status == statusOK {
+				status = statusDegraded
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":       status,
+			"database":     database,
+			"dependencies": dependencies,
+		})
+	}
+}
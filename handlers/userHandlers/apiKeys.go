@@ -0,0 +1,85 @@
+package userHandlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/middlewares"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/apiKeyService"
+)
+
+// HandleAPIKeys lists (GET), creates (POST) and revokes (DELETE ?key_id=)
+// the authenticated user's API keys.
+func HandleAPIKeys(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middlewares.CurrentUserID(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			keys, err := apiKeyService.List(db, userID)
+			if err != nil {
+				http.Error(w, "Failed to load API keys", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(keys)
+
+		case http.MethodPost:
+			var requestBody struct {
+				Name      string     `json:"name"`
+				Scopes    []string   `json:"scopes"`
+				ExpiresAt *time.Time `json:"expires_at"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+
+			key, secret, err := apiKeyService.Create(db, userID, requestBody.Name, requestBody.Scopes, requestBody.ExpiresAt)
+			if err != nil {
+				var invalid apiKeyService.ErrInvalidAPIKeyRequest
+				if errors.As(err, &invalid) {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(struct {
+				*models.APIKey
+				Key string `json:"key"`
+			}{key, secret})
+
+		case http.MethodDelete:
+			keyID, err := strconv.ParseInt(r.URL.Query().Get("key_id"), 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid API key ID", http.StatusBadRequest)
+				return
+			}
+			if err := apiKeyService.Revoke(db, userID, keyID); err != nil {
+				if errors.Is(err, models.ErrAPIKeyNotFound) {
+					http.Error(w, err.Error(), http.StatusNotFound)
+					return
+				}
+				http.Error(w, "Failed to revoke API key", http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
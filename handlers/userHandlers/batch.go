@@ -0,0 +1,96 @@
+package userHandlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/middlewares"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/batchService"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/operationService"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/rateLimitService"
+)
+
+func sendBatchJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func PerformBatchOperation(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := middlewares.CurrentUserID(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var requestBody struct {
+			Mode       string                      `json:"mode"`
+			Operations []operationService.Operands `json:"operations"`
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBatchBodyBytes)
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			sendPayloadError(w, err)
+			return
+		}
+
+		items := make([]batchService.Item, len(requestBody.Operations))
+		for i, operands := range requestBody.Operations {
+			if operands == nil {
+				http.Error(w, "Invalid request payload", http.StatusBadRequest)
+				return
+			}
+			operationType, operands, err := splitOperationType(operands)
+			if err != nil {
+				http.Error(w, "Invalid request payload", http.StatusBadRequest)
+				return
+			}
+			items[i] = batchService.Item{OperationType: operationType, Operands: operands}
+		}
+
+		batch, err := batchService.Prepare(db, items, requestBody.Mode)
+		if err != nil {
+			var invalid batchService.ErrInvalidBatch
+			switch {
+			case errors.As(err, &invalid):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			case errors.Is(err, batchService.ErrInvalidItems):
+				sendBatchJSON(w, http.StatusBadRequest, map[string]interface{}{"error": err.Error(), "items": batch.Results()})
+			case errors.Is(err, models.ErrMoneyOutOfRange):
+				http.Error(w, "Batch cost is out of range", http.StatusBadRequest)
+			default:
+				log.Printf("Error preparing batch: %v", err)
+				http.Error(w, "Failed to price operations", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		for _, operationType := range batch.Operations() {
+			if !middlewares.EnforceRateLimit(w, r, db, rateLimitService.OperationScope(operationType)) {
+				return
+			}
+		}
+
+		result, err := batchService.Run(db, userID, batch)
+		switch {
+		case errors.Is(err, batchService.ErrBatchFailed):
+			sendBatchJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{"error": err.Error(), "batch": result})
+		case errors.Is(err, models.ErrInsufficientCredits):
+			http.Error(w, "Insufficient credits", http.StatusPaymentRequired)
+		case err != nil:
+			log.Printf("Error running batch: %v", err)
+			http.Error(w, "Failed to record operations", http.StatusInternalServerError)
+		default:
+			sendBatchJSON(w, http.StatusOK, result)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package userHandlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/middlewares"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/jobService"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/operationService"
+)
+
+type jobResponse struct {
+	*models.Job
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+func newJobResponse(job *models.Job) jobResponse {
+	response := jobResponse{Job: job}
+	if job.Result != nil {
+		response.Result = json.RawMessage(*job.Result)
+	}
+	return response
+}
+
+func jobURL(jobID int64) string {
+	return "/api/v1/jobs/" + strconv.FormatInt(jobID, 10)
+}
+
+// enqueueOperation answers an ?async=true operation request: the cost is
+// held and the job id returned with 202 for the client to poll.
+func enqueueOperation(w http.ResponseWriter, db *sql.DB, userID int64, operation *models.Operation, op operationService.Operation, operands operationService.Operands, cost models.Money) {
+	job, err := jobService.Enqueue(db, userID, operation, op, operands, cost)
+	if err != nil {
+		if errors.Is(err, models.ErrInsufficientCredits) {
+			http.Error(w, "Insufficient credits", http.StatusPaymentRequired)
+			return
+		}
+		log.Printf("Error enqueueing job: %v", err)
+		http.Error(w, "Failed to enqueue operation", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", jobURL(job.ID))
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"job_id": job.ID,
+		"status": job.Status,
+		"cost":   job.HoldAmount,
+		"url":    jobURL(job.ID),
+	})
+}
+
+func GetJob(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := middlewares.CurrentUserID(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		jobID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid job ID", http.StatusBadRequest)
+			return
+		}
+
+		job, err := jobService.GetJob(db, userID, jobID)
+		if err != nil {
+			if errors.Is(err, models.ErrJobNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			log.Printf("Error retrieving job: %v", err)
+			http.Error(w, "Failed to retrieve job", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newJobResponse(job))
+	}
+}
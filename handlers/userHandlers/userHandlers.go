@@ -3,28 +3,26 @@ package userHandlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"math"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/middlewares"
 	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
-	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/authHelpers"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/billingService"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/ledgerService"
 	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/operationService"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/rateLimitService"
 	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/recordService"
 	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/userService"
 )
 
-type OperationRequest struct {
-	OperationType string  `json:"operation_type"`
-	A             float64 `json:"a"`
-	B             float64 `json:"b,omitempty"`
-}
-
 func HandleCredits(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID, err := authHelpers.GetUserIDFromToken(r)
+		userID, err := middlewares.CurrentUserID(r)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
@@ -37,12 +35,17 @@ func HandleCredits(db *sql.DB) http.HandlerFunc {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
+			held, err := userService.GetHeldCredits(db, userID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
 			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(map[string]float64{"credits": credits})
+			json.NewEncoder(w).Encode(map[string]models.Money{"credits": credits, "held_credits": held})
 
 		case http.MethodPut:
 			var requestBody struct {
-				Credits float64           `json:"credits"`
+				Credits models.Money      `json:"credits"`
 				Action  models.ActionType `json:"action"`
 			}
 			if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
@@ -52,12 +55,24 @@ func HandleCredits(db *sql.DB) http.HandlerFunc {
 
 			if requestBody.Action == models.AddAction {
 				err := userService.AddCreditsToUser(db, userID, requestBody.Credits)
+				if errors.Is(err, models.ErrInvalidAmount) || errors.Is(err, models.ErrMoneyOutOfRange) {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
 				if err != nil {
 					http.Error(w, err.Error(), http.StatusInternalServerError)
 					return
 				}
 			} else if requestBody.Action == models.RemoveAction {
 				err := userService.RemoveCreditsFromUser(db, userID, requestBody.Credits)
+				if errors.Is(err, models.ErrInvalidAmount) || errors.Is(err, models.ErrMoneyOutOfRange) {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				if errors.Is(err, models.ErrInsufficientCredits) {
+					http.Error(w, err.Error(), http.StatusPaymentRequired)
+					return
+				}
 				if err != nil {
 					http.Error(w, err.Error(), http.StatusInternalServerError)
 					return
@@ -76,91 +91,197 @@ func HandleCredits(db *sql.DB) http.HandlerFunc {
 	}
 }
 
+const (
+	maxOperationBodyBytes = 1 << 20
+	maxBatchBodyBytes     = 4 << 20
+)
+
+// sendPayloadError answers a body that failed to decode, including one cut
+// off by http.MaxBytesReader.
+func sendPayloadError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, "Invalid request payload", http.StatusBadRequest)
+}
+
+func decodeOperationRequest(w http.ResponseWriter, r *http.Request) (string, operationService.Operands, error) {
+	var operands operationService.Operands
+	r.Body = http.MaxBytesReader(w, r.Body, maxOperationBodyBytes)
+	if err := json.NewDecoder(r.Body).Decode(&operands); err != nil {
+		return "", nil, err
+	}
+	return splitOperationType(operands)
+}
+
+// splitOperationType removes "operation_type" from a request object and
+// returns it separately from the operands.
+func splitOperationType(operands operationService.Operands) (string, operationService.Operands, error) {
+	var operationType string
+	if raw, ok := operands["operation_type"]; ok {
+		if err := json.Unmarshal(raw, &operationType); err != nil {
+			return "", nil, err
+		}
+		delete(operands, "operation_type")
+	}
+	return operationType, operands, nil
+}
+
+// operationUnavailable reports whether err means an operation, or a
+// primitive it is priced by, is missing from the catalog or deactivated.
+func operationUnavailable(err error) bool {
+	return errors.Is(err, models.ErrOperationNotFound) || errors.Is(err, models.ErrOperationInactive)
+}
+
+func sendOperationError(w http.ResponseWriter, err error) {
+	var exprErr *operationService.ExpressionError
+	if errors.As(err, &exprErr) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(exprErr)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
 func PerformOperation(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID, err := authHelpers.GetUserIDFromToken(r)
+		userID, err := middlewares.CurrentUserID(r)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
 
-		var req OperationRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		operationType, operands, err := decodeOperationRequest(w, r)
+		if err != nil {
+			sendPayloadError(w, err)
+			return
+		}
+
+		op, ok := operationService.Lookup(operationType)
+		if !ok {
+			http.Error(w, "Invalid operation type", http.StatusBadRequest)
+			return
+		}
+
+		if !middlewares.EnforceRateLimit(w, r, db, rateLimitService.OperationScope(op.Name())) {
+			return
+		}
+
+		if err := operationService.Validate(op, operands); err != nil {
+			sendOperationError(w, err)
 			return
 		}
 
-		operation, err := operationService.GetOperation(db, req.OperationType)
+		async := false
+		if asyncStr := r.URL.Query().Get("async"); asyncStr != "" {
+			async, err = strconv.ParseBool(asyncStr)
+			if err != nil {
+				http.Error(w, "Invalid async parameter", http.StatusBadRequest)
+				return
+			}
+		}
+		if async && !operationService.SupportsAsync(op) {
+			http.Error(w, "Operation does not support async execution", http.StatusBadRequest)
+			return
+		}
+
+		operation, err := operationService.GetOperation(db, op.Name())
+		if operationUnavailable(err) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
 		if err != nil {
 			http.Error(w, "Failed to retrieve operation", http.StatusInternalServerError)
 			return
 		}
 
-		credits, err := userService.GetUserCredits(db, userID)
-		if err != nil {
-			http.Error(w, "Failed to retrieve user credits", http.StatusInternalServerError)
+		cost, err := operationService.OperationCost(db, operation, op, operands)
+		if errors.Is(err, models.ErrMoneyOutOfRange) {
+			http.Error(w, "Operation cost is out of range", http.StatusBadRequest)
 			return
 		}
-		if credits < operation.Cost {
-			http.Error(w, "Insufficient credits", http.StatusPaymentRequired)
+		if operationUnavailable(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to price operation", http.StatusInternalServerError)
 			return
 		}
 
-		var result interface{}
-		switch req.OperationType {
-		case "addition":
-			result = operationService.Addition(req.A, req.B)
-		case "subtraction":
-			result = operationService.Subtraction(req.A, req.B)
-		case "multiplication":
-			result = operationService.Multiplication(req.A, req.B)
-		case "division":
-			result, err = operationService.Division(req.A, req.B)
-		case "square_root":
-			result, err = operationService.SquareRoot(req.A)
-		case "random_string":
-			result, err = operationService.RandomString()
-		default:
-			http.Error(w, "Invalid operation type", http.StatusBadRequest)
+		if async {
+			enqueueOperation(w, db, userID, operation, op, operands, cost)
 			return
 		}
 
+		credits, err := userService.GetUserCredits(db, userID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			http.Error(w, "Failed to retrieve user credits", http.StatusInternalServerError)
+			return
+		}
+		if credits < cost {
+			http.Error(w, "Insufficient credits", http.StatusPaymentRequired)
 			return
 		}
 
-		var resultString string
-		switch v := result.(type) {
-		case string:
-			resultString = v
-		case float64:
-			resultString = strconv.FormatFloat(v, 'f', -1, 64)
-		default:
-			http.Error(w, "Unsupported result type", http.StatusInternalServerError)
+		result, err := operationService.Evaluate(op, operands)
+		if err != nil {
+			sendOperationError(w, err)
 			return
 		}
 
-		if err := userService.RemoveCreditsFromUser(db, userID, operation.Cost); err != nil {
-			http.Error(w, "Failed to deduct credits", http.StatusInternalServerError)
+		response, err := operationService.RecordResponse(op, operands, result)
+		if err != nil {
+			http.Error(w, "Unsupported result type", http.StatusInternalServerError)
 			return
 		}
 
-		if err := recordService.CreateRecord(db, operation.ID, userID, operation.Cost, credits-operation.Cost, resultString); err != nil {
+		charge, err := billingService.ChargeOperation(db, userID, operation.ID, cost, response)
+		if err != nil {
+			if errors.Is(err, models.ErrInsufficientCredits) {
+				http.Error(w, "Insufficient credits", http.StatusPaymentRequired)
+				return
+			}
 			http.Error(w, "Failed to record operation", http.StatusInternalServerError)
 			return
 		}
 
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]interface{}{"result": result})
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": result, "cost": cost, "balance": charge.Balance})
+	}
+}
+
+// targetUserID resolves whose data a request reads: the caller's own by
+// default, or the "user_id" query parameter when the caller's roles grant
+// permission to read any user's data.
+func targetUserID(r *http.Request, permission string) (int64, int, error) {
+	principal, err := middlewares.CurrentPrincipal(r)
+	if err != nil {
+		return 0, http.StatusUnauthorized, errors.New("Unauthorized")
+	}
+
+	userIDStr := r.URL.Query().Get("user_id")
+	if userIDStr == "" {
+		return principal.UserID, 0, nil
+	}
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return 0, http.StatusBadRequest, errors.New("Invalid user ID")
 	}
+	if userID != principal.UserID && !principal.HasPermission(permission) {
+		return 0, http.StatusForbidden, errors.New("Forbidden")
+	}
+	return userID, 0, nil
 }
 
 func GetRecordsHistory(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID, err := authHelpers.GetUserIDFromToken(r)
+		userID, status, err := targetUserID(r, models.PermRecordsReadAny)
 		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			http.Error(w, err.Error(), status)
 			return
 		}
 
@@ -233,7 +354,7 @@ func GetRecordsHistory(db *sql.DB) http.HandlerFunc {
 
 func DeleteRecordHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID, err := authHelpers.GetUserIDFromToken(r)
+		userID, err := middlewares.CurrentUserID(r)
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -266,9 +387,50 @@ func DeleteRecordHandler(db *sql.DB) http.HandlerFunc {
 	}
 }
 
+func GetLedger(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, status, err := targetUserID(r, models.PermLedgerReadAny)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		limit := 10
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			if parsed, err := strconv.Atoi(limitStr); err == nil && parsed > 0 {
+				limit = parsed
+			}
+		}
+		offset := 0
+		if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+			if parsed, err := strconv.Atoi(offsetStr); err == nil && parsed >= 0 {
+				offset = parsed
+			}
+		}
+
+		entries, totalRecords, err := ledgerService.GetEntries(db, userID, limit, offset)
+		if err != nil {
+			log.Printf("Error retrieving ledger entries: %v", err)
+			http.Error(w, "Failed to retrieve ledger", http.StatusInternalServerError)
+			return
+		}
+
+		response := models.LedgerPage{
+			TotalRecords:   totalRecords,
+			CurrentPage:    (offset / limit) + 1,
+			TotalPages:     int(math.Ceil(float64(totalRecords) / float64(limit))),
+			RecordsPerPage: limit,
+			Entries:        entries,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
 func GetOperations(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		operations, err := userService.GetAllOperations(db)
+		operations, err := operationService.ListOperations(db)
 		if err != nil {
 			log.Printf("Error retrieving operations: %v", err)
 			http.Error(w, "Failed to retrieve operations", http.StatusInternalServerError)
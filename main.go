@@ -1,19 +1,43 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/Ignacio-J-Maylin/arithmetic-calculator/config"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/handlers/adminHandlers"
 	"github.com/Ignacio-J-Maylin/arithmetic-calculator/handlers/authHandlers"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/handlers/healthHandlers"
 	"github.com/Ignacio-J-Maylin/arithmetic-calculator/handlers/userHandlers"
 	"github.com/Ignacio-J-Maylin/arithmetic-calculator/middlewares"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/authHelpers"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/emailVerificationService"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/idempotencyService"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/jobService"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/keyManager"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/loginThrottleService"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/mailService"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/mfaService"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/passwordResetService"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/randomService"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/rateLimitService"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/sessionService"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/userService"
 	"github.com/joho/godotenv"
 )
 
 func main() {
+	bootstrapAdmin := flag.String("bootstrap-admin", "", "username to grant the admin role at startup (defaults to BOOTSTRAP_ADMIN)")
+	flag.Parse()
 
 	if os.Getenv("ENV") != "production" {
 		err := godotenv.Load()
@@ -22,6 +46,10 @@ func main() {
 		}
 	}
 
+	if *bootstrapAdmin == "" {
+		*bootstrapAdmin = os.Getenv("BOOTSTRAP_ADMIN")
+	}
+
 	db, err := config.ConnectDB()
 	if err != nil {
 		log.Fatalf("Error conectándose a la base de datos: %v", err)
@@ -36,17 +64,149 @@ func main() {
 
 	log.Println("Migraciones ejecutadas correctamente.")
 
+	if *bootstrapAdmin != "" {
+		if err := userService.BootstrapAdmin(db, *bootstrapAdmin); err != nil {
+			log.Fatalf("Error asignando el rol admin: %v", err)
+		}
+		log.Printf("Rol admin asignado a %s", *bootstrapAdmin)
+	}
+
+	keys, err := keyManager.LoadFromEnv(config.GetDuration("JWT_CLOCK_SKEW", 30*time.Second))
+	if err != nil {
+		log.Fatalf("Error cargando las claves JWT: %v", err)
+	}
+	middlewares.SetKeyManager(keys)
+	middlewares.SetAccessTokenLifetime(config.GetDuration("ACCESS_TOKEN_TTL", 5*time.Minute))
+
+	sessionService.SetLifetimes(
+		config.GetDuration("SESSION_IDLE_TIMEOUT", 30*time.Minute),
+		config.GetDuration("SESSION_MAX_LIFETIME", 24*time.Hour),
+	)
+	middlewares.SetSessionChecker(func(sessionID string) error {
+		return sessionService.Touch(db, sessionID)
+	})
+	middlewares.SetUserLoader(authHelpers.UserLoader(db))
+	middlewares.SetAPIKeyAuthenticator(authHelpers.APIKeyAuthenticator(db))
+
+	mailer, err := mailService.LoadFromEnv()
+	if err != nil {
+		log.Fatalf("Error configurando el envío de correo: %v", err)
+	}
+	mailService.SetMailer(mailer, os.Getenv("MAIL_FROM"))
+
+	randomProvider, err := randomService.LoadFromEnv()
+	if err != nil {
+		log.Fatalf("Error configurando la fuente de aleatoriedad: %v", err)
+	}
+	randomService.SetProvider(randomProvider)
+
+	// Background workers stop taking new work on SIGINT/SIGTERM and are
+	// waited for after the HTTP server has shut down.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var drains []func()
+
+	passwordResetService.Configure(
+		config.GetDuration("PASSWORD_RESET_TTL", time.Hour),
+		os.Getenv("PASSWORD_RESET_URL"),
+	)
+	drains = append(drains, passwordResetService.StartWorkers(ctx, config.GetInt("MAIL_WORKERS", 2), config.GetInt("MAIL_QUEUE_SIZE", 100)))
+
+	emailVerificationService.Configure(
+		keys,
+		config.GetDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour),
+		config.GetDuration("EMAIL_VERIFICATION_RESEND_INTERVAL", time.Minute),
+		os.Getenv("EMAIL_VERIFICATION_URL"),
+	)
+	drains = append(drains, emailVerificationService.StartWorkers(ctx, config.GetInt("MAIL_WORKERS", 2), config.GetInt("MAIL_QUEUE_SIZE", 100)))
+
+	mfaService.Configure(keys, os.Getenv("MFA_ISSUER"), config.GetDuration("MFA_CHALLENGE_TTL", 5*time.Minute))
+
+	middlewares.SetTrustProxyHeaders(config.GetBool("TRUST_PROXY_HEADERS", false))
+
+	loginPolicy := loginThrottleService.Policy{
+		UserThreshold:   config.GetInt("LOGIN_LOCKOUT_THRESHOLD", loginThrottleService.DefaultPolicy.UserThreshold),
+		IPThreshold:     config.GetInt("LOGIN_IP_LOCKOUT_THRESHOLD", loginThrottleService.DefaultPolicy.IPThreshold),
+		BaseDelay:       config.GetDuration("LOGIN_BACKOFF_BASE", loginThrottleService.DefaultPolicy.BaseDelay),
+		MaxDelay:        config.GetDuration("LOGIN_BACKOFF_MAX", loginThrottleService.DefaultPolicy.MaxDelay),
+		LockoutDuration: config.GetDuration("LOGIN_LOCKOUT_DURATION", loginThrottleService.DefaultPolicy.LockoutDuration),
+		Window:          config.GetDuration("LOGIN_FAILURE_WINDOW", loginThrottleService.DefaultPolicy.Window),
+	}
+	switch store := config.GetString("LOGIN_THROTTLE_STORE", "memory"); store {
+	case "memory":
+		loginThrottleService.Configure(loginThrottleService.NewMemoryStore(loginPolicy.Window), loginPolicy)
+	case "database":
+		loginThrottleService.Configure(loginThrottleService.NewDatabaseStore(db), loginPolicy)
+	default:
+		log.Fatalf("LOGIN_THROTTLE_STORE desconocido: %q", store)
+	}
+
+	rateLimits, err := rateLimitService.ParseLimits(os.Getenv("RATE_LIMITS"))
+	if err != nil {
+		log.Fatalf("RATE_LIMITS inválido: %v", err)
+	}
+	var defaultRateLimit *rateLimitService.Limit
+	if value := config.GetString("RATE_LIMIT_DEFAULT", "120/1m"); value != "off" {
+		limit, err := rateLimitService.ParseLimit(value)
+		if err != nil {
+			log.Fatalf("RATE_LIMIT_DEFAULT inválido: %v", err)
+		}
+		defaultRateLimit = &limit
+	}
+	switch store := config.GetString("RATE_LIMIT_STORE", "memory"); store {
+	case "memory":
+		rateLimitService.Configure(rateLimitService.NewMemoryStore(), defaultRateLimit, rateLimits)
+	case "database":
+		rateLimitService.Configure(rateLimitService.NewDatabaseStore(db), defaultRateLimit, rateLimits)
+	default:
+		log.Fatalf("RATE_LIMIT_STORE desconocido: %q", store)
+	}
+	rateLimitService.StartSweeper(config.GetDuration("RATE_LIMIT_SWEEP_INTERVAL", time.Minute))
+
+	models.SetMoneyJSONNumeric(config.GetBool("MONEY_JSON_NUMERIC", false))
+
+	idempotencyWindow := config.GetDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour)
+	idempotencyService.StartPurger(db, config.GetDuration("IDEMPOTENCY_PURGE_INTERVAL", time.Hour))
+
+	jobService.Configure(
+		config.GetDuration("JOB_LEASE_TIMEOUT", 2*time.Minute),
+		config.GetDuration("JOB_POLL_INTERVAL", time.Second),
+		config.GetInt("JOB_MAX_ATTEMPTS", 3),
+	)
+	drains = append(drains, jobService.StartWorkers(ctx, db, config.GetInt("JOB_WORKERS", 2)))
+
 	mux := http.NewServeMux()
 
-	mux.Handle("/api/v1/users/credits", middlewares.AuthMiddleware(http.HandlerFunc(userHandlers.HandleCredits(db))))
-	mux.Handle("/api/v1/users/operation", middlewares.AuthMiddleware(http.HandlerFunc(userHandlers.PerformOperation(db))))
-	mux.Handle("/api/v1/records/history", middlewares.AuthMiddleware(http.HandlerFunc(userHandlers.GetRecordsHistory(db))))
-	mux.Handle("/api/v1/records/delete", middlewares.AuthMiddleware(http.HandlerFunc(userHandlers.DeleteRecordHandler(db))))
+	mux.Handle("/api/v1/users/credits", middlewares.AuthMiddleware(middlewares.RateLimit(db, "credits")(middlewares.RequirePermission(models.PermCreditsManageOwn)(middlewares.RequireVerifiedEmail(middlewares.IdempotencyMiddleware(db, idempotencyWindow, http.HandlerFunc(userHandlers.HandleCredits(db))))))))
+	mux.Handle("/api/v1/users/operation", middlewares.AuthMiddleware(middlewares.RateLimit(db, "operation")(middlewares.RequirePermission(models.PermOperationsPerform)(middlewares.RequireVerifiedEmail(middlewares.IdempotencyMiddleware(db, idempotencyWindow, http.HandlerFunc(userHandlers.PerformOperation(db))))))))
+	mux.Handle("/api/v1/users/operations/batch", middlewares.AuthMiddleware(middlewares.RateLimit(db, "operation")(middlewares.RequirePermission(models.PermOperationsPerform)(middlewares.RequireVerifiedEmail(middlewares.IdempotencyMiddleware(db, idempotencyWindow, http.HandlerFunc(userHandlers.PerformBatchOperation(db))))))))
+	mux.Handle("/api/v1/jobs/{id}", middlewares.AuthMiddleware(middlewares.RateLimit(db, "jobs")(middlewares.RequirePermission(models.PermOperationsPerform)(http.HandlerFunc(userHandlers.GetJob(db))))))
+	mux.Handle("/api/v1/users/api-keys", middlewares.AuthMiddleware(middlewares.RequireInteractiveLogin(http.HandlerFunc(userHandlers.HandleAPIKeys(db)))))
+	mux.Handle("/api/v1/users/ledger", middlewares.AuthMiddleware(middlewares.RateLimit(db, "ledger")(middlewares.RequirePermission(models.PermLedgerReadOwn)(http.HandlerFunc(userHandlers.GetLedger(db))))))
+	mux.Handle("/api/v1/records/history", middlewares.AuthMiddleware(middlewares.RateLimit(db, "records")(middlewares.RequirePermission(models.PermRecordsReadOwn)(http.HandlerFunc(userHandlers.GetRecordsHistory(db))))))
+	mux.Handle("/api/v1/records/delete", middlewares.AuthMiddleware(middlewares.RateLimit(db, "records")(middlewares.RequirePermission(models.PermRecordsDeleteOwn)(http.HandlerFunc(userHandlers.DeleteRecordHandler(db))))))
 
-	mux.HandleFunc("/api/v1/logout", http.HandlerFunc(authHandlers.Logout()))
-	mux.HandleFunc("/api/v1/login", authHandlers.Login(db))
-	mux.HandleFunc("/api/v1/refresh", authHandlers.RefreshToken(db))
-	mux.HandleFunc("/api/v1/signup", authHandlers.SignUp(db))
+	mux.Handle("/api/v1/admin/operations", middlewares.AuthMiddleware(middlewares.RequirePermission(models.PermOperationsManage)(http.HandlerFunc(adminHandlers.HandleOperations(db)))))
+	mux.Handle("/api/v1/admin/operations/price-history", middlewares.AuthMiddleware(middlewares.RequirePermission(models.PermOperationsManage)(http.HandlerFunc(adminHandlers.GetOperationPriceHistory(db)))))
+	mux.Handle("/api/v1/admin/users/roles", middlewares.AuthMiddleware(middlewares.RequirePermission(models.PermUsersManage)(http.HandlerFunc(adminHandlers.HandleUserRoles(db)))))
+	mux.Handle("/api/v1/admin/login-lockouts", middlewares.AuthMiddleware(middlewares.RequirePermission(models.PermUsersManage)(http.HandlerFunc(adminHandlers.HandleLoginLockouts()))))
+	mux.Handle("/api/v1/admin/users/rate-limits", middlewares.AuthMiddleware(middlewares.RequirePermission(models.PermUsersManage)(http.HandlerFunc(adminHandlers.HandleRateLimitOverrides(db)))))
+	mux.Handle("/api/v1/admin/users/credits", middlewares.AuthMiddleware(middlewares.RequirePermission(models.PermCreditsGrant)(http.HandlerFunc(adminHandlers.GrantCredits(db)))))
+
+	mux.HandleFunc("/api/v1/health", healthHandlers.Health(db))
+	mux.HandleFunc("/.well-known/jwks.json", authHandlers.JWKS())
+	mux.HandleFunc("/api/v1/logout", authHandlers.Logout(db))
+	mux.Handle("/api/v1/login", middlewares.RateLimit(db, "login")(authHandlers.Login(db)))
+	mux.Handle("/api/v1/login/mfa", middlewares.RateLimit(db, "login")(authHandlers.LoginMFA(db)))
+	mux.Handle("/api/v1/mfa/enroll", middlewares.AuthMiddleware(middlewares.RequireInteractiveLogin(http.HandlerFunc(authHandlers.EnrollMFA(db)))))
+	mux.Handle("/api/v1/mfa/activate", middlewares.AuthMiddleware(middlewares.RequireInteractiveLogin(http.HandlerFunc(authHandlers.ActivateMFA(db)))))
+	mux.Handle("/api/v1/mfa/disable", middlewares.AuthMiddleware(middlewares.RequireInteractiveLogin(http.HandlerFunc(authHandlers.DisableMFA(db)))))
+	mux.Handle("/api/v1/refresh", middlewares.RateLimit(db, "refresh")(authHandlers.RefreshToken(db)))
+	mux.Handle("/api/v1/signup", middlewares.RateLimit(db, "signup")(authHandlers.SignUp(db)))
+	mux.Handle("/api/v1/verify-email", middlewares.RateLimit(db, "verify_email")(authHandlers.VerifyEmail(db)))
+	mux.Handle("/api/v1/verify-email/resend", middlewares.AuthMiddleware(middlewares.RequireInteractiveLogin(http.HandlerFunc(authHandlers.ResendVerification(db)))))
+	mux.Handle("/api/v1/password/forgot", middlewares.RateLimit(db, "password")(authHandlers.ForgotPassword(db)))
+	mux.Handle("/api/v1/password/reset", middlewares.RateLimit(db, "password")(authHandlers.ResetPassword(db)))
 	mux.HandleFunc("/api/v1/operations", userHandlers.GetOperations(db))
 
 	corsMux := middlewares.CorsMiddleware(mux)
@@ -55,6 +215,23 @@ func main() {
 	if port == "" {
 		port = "8080"
 	}
+	server := &http.Server{Addr: ":" + port, Handler: corsMux}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), config.GetDuration("SHUTDOWN_TIMEOUT", 30*time.Second))
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Error cerrando el servidor: %v", err)
+		}
+	}()
+
 	fmt.Printf("Server running on port %s\n", port)
-	log.Fatal(http.ListenAndServe(":"+port, corsMux))
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+
+	for _, drain := range drains {
+		drain()
+	}
+	log.Println("Servidor detenido")
 }
@@ -0,0 +1,45 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+)
+
+// APIKeyScheme is the Authorization scheme for personal API keys.
+const APIKeyScheme = "ApiKey"
+
+var apiKeyAuthenticator func(key, ip string) (*models.APIKey, error)
+
+// SetAPIKeyAuthenticator installs the lookup AuthMiddleware uses for
+// "Authorization: ApiKey" requests. It must return models.ErrInvalidAPIKey
+// for unknown, revoked or expired keys.
+func SetAPIKeyAuthenticator(authenticate func(key, ip string) (*models.APIKey, error)) {
+	apiKeyAuthenticator = authenticate
+}
+
+func authenticateAPIKey(key, ip string) (*models.APIKey, error) {
+	if apiKeyAuthenticator == nil {
+		return nil, errors.New("API keys are not configured")
+	}
+	return apiKeyAuthenticator(key, ip)
+}
+
+// RequireInteractiveLogin rejects requests authenticated with an API key,
+// for endpoints such as key management that a leaked key must not reach.
+// Must run after AuthMiddleware.
+func RequireInteractiveLogin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := CurrentPrincipal(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if principal.AuthMethod != AuthMethodJWT {
+			http.Error(w, "This endpoint requires a user login, not an API key", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -3,55 +3,91 @@ package middlewares
 import (
 	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/keyManager"
 	"github.com/golang-jwt/jwt/v4"
 )
 
-var jwtSecret = []byte("JWT_SECRET_KEY")
+var (
+	keys                *keyManager.KeyManager
+	accessTokenLifetime = 5 * time.Minute
+	sessionChecker      func(sessionID string) error
+)
+
+// SetKeyManager installs the keys used to sign and verify access tokens.
+func SetKeyManager(km *keyManager.KeyManager) {
+	keys = km
+}
+
+func Keys() *keyManager.KeyManager {
+	return keys
+}
+
+func SetAccessTokenLifetime(d time.Duration) {
+	accessTokenLifetime = d
+}
+
+func AccessTokenLifetime() time.Duration {
+	return accessTokenLifetime
+}
+
+// SetSessionChecker installs the callback AuthMiddleware uses to reject
+// access tokens whose session was revoked or has timed out.
+func SetSessionChecker(check func(sessionID string) error) {
+	sessionChecker = check
+}
+
+// TokenTypeAccess is the only "typ" accepted by ValidateJWT; refresh tokens
+// are opaque and never JWTs, so the two kinds cannot be swapped.
+const TokenTypeAccess = "access"
 
 type Claims struct {
-	UserID   int64  `json:"user_id"`
-	Username string `json:"username"`
+	UserID    int64    `json:"user_id"`
+	Username  string   `json:"username"`
+	Roles     []string `json:"roles,omitempty"`
+	SessionID string   `json:"sid,omitempty"`
+	TokenType string   `json:"typ"`
 	jwt.StandardClaims
 }
 
-func GenerateJWT(userID int64, username string) (string, error) {
-	expirationTime := time.Now().Add(30 * time.Second)
-	claims := &Claims{
-		UserID:   userID,
-		Username: username,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
-		},
+func GenerateJWT(userID int64, username string, roles []string, sessionID string) (string, error) {
+	if keys == nil {
+		return "", errors.New("signing keys not configured")
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
-}
 
-func GenerateRefreshToken(userID int64, username string) (string, error) {
-	expirationTime := time.Now().Add(600 * time.Second)
+	now := time.Now()
+	expirationTime := now.Add(accessTokenLifetime)
 	claims := &Claims{
-		UserID:   userID,
-		Username: username,
+		UserID:    userID,
+		Username:  username,
+		Roles:     roles,
+		SessionID: sessionID,
+		TokenType: TokenTypeAccess,
 		StandardClaims: jwt.StandardClaims{
+			Issuer:    keys.Issuer,
+			Audience:  keys.Audience,
+			Subject:   strconv.FormatInt(userID, 10),
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Unix(),
 			ExpiresAt: expirationTime.Unix(),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	return keys.Sign(claims)
 }
 
 func ValidateJWT(tokenStr string) (*Claims, error) {
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
+	if keys == nil {
+		return nil, errors.New("signing keys not configured")
+	}
 
+	claims := &Claims{}
+	parser := jwt.NewParser(jwt.WithValidMethods(keys.ValidMethods()), jwt.WithoutClaimsValidation())
+	token, err := parser.ParseWithClaims(tokenStr, claims, keys.Keyfunc)
 	if err != nil {
-		if errors.Is(err, jwt.ErrTokenExpired) {
-			return nil, errors.New("token expired")
-		}
 		return nil, err
 	}
 
@@ -59,19 +95,79 @@ func ValidateJWT(tokenStr string) (*Claims, error) {
 		return nil, errors.New("invalid token")
 	}
 
+	leeway := int64(keys.Leeway / time.Second)
+	now := time.Now().Unix()
+	if !claims.VerifyExpiresAt(now-leeway, true) {
+		return nil, errors.New("token expired")
+	}
+	if !claims.VerifyNotBefore(now+leeway, true) {
+		return nil, errors.New("token not valid yet")
+	}
+	if !claims.VerifyIssuedAt(now+leeway, false) {
+		return nil, errors.New("token used before issued")
+	}
+	if !claims.VerifyIssuer(keys.Issuer, true) {
+		return nil, errors.New("invalid token issuer")
+	}
+	if !claims.VerifyAudience(keys.Audience, true) {
+		return nil, errors.New("invalid token audience")
+	}
+
+	if claims.TokenType != TokenTypeAccess {
+		return nil, errors.New("invalid token type")
+	}
+
 	return claims, nil
 }
 
+// sendPrincipalError answers for a token or key whose user cannot be used.
+func sendPrincipalError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrAccountDisabled):
+		http.Error(w, "Account is disabled", http.StatusForbidden)
+	case errors.Is(err, models.ErrUserNotFound):
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	default:
+		http.Error(w, "Error loading user", http.StatusInternalServerError)
+	}
+}
+
+// AuthMiddleware accepts "Authorization: Bearer <jwt>" and
+// "Authorization: ApiKey <key>", loads the caller's account and stores it
+// in the request context as a *Principal.
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
+		if strings.HasPrefix(authHeader, APIKeyScheme+" ") {
+			apiKey, err := authenticateAPIKey(strings.TrimPrefix(authHeader, APIKeyScheme+" "), ClientIP(r))
+			if err != nil {
+				if errors.Is(err, models.ErrInvalidAPIKey) {
+					http.Error(w, "Invalid API key", http.StatusUnauthorized)
+					return
+				}
+				http.Error(w, "Error checking API key", http.StatusInternalServerError)
+				return
+			}
+
+			principal, err := loadPrincipal(apiKey.UserID, AuthMethodAPIKey)
+			if err != nil {
+				sendPrincipalError(w, err)
+				return
+			}
+			principal.Scopes = apiKey.Scopes
+			principal.APIKeyID = apiKey.ID
+
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+			return
+		}
+
 		if authHeader == "" || len(authHeader) < 8 || authHeader[:7] != "Bearer " {
 			http.Error(w, "Missing or invalid token", http.StatusUnauthorized)
 			return
 		}
 
 		tokenString := authHeader[7:]
-		_, err := ValidateJWT(tokenString)
+		claims, err := ValidateJWT(tokenString)
 
 		if err != nil {
 			if err.Error() == "token expired" {
@@ -82,6 +178,24 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		if sessionChecker != nil && claims.SessionID != "" {
+			if err := sessionChecker(claims.SessionID); err != nil {
+				if errors.Is(err, models.ErrSessionExpired) {
+					http.Error(w, "Session expired", http.StatusUnauthorized)
+					return
+				}
+				http.Error(w, "Error checking session", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		principal, err := loadPrincipal(claims.UserID, AuthMethodJWT)
+		if err != nil {
+			sendPrincipalError(w, err)
+			return
+		}
+		principal.SessionID = claims.SessionID
+
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
 	})
 }
@@ -0,0 +1,31 @@
+package middlewares
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+var trustProxyHeaders bool
+
+// SetTrustProxyHeaders makes ClientIP honour X-Forwarded-For and X-Real-IP.
+// Only enable it behind a proxy that overwrites those headers.
+func SetTrustProxyHeaders(trust bool) {
+	trustProxyHeaders = trust
+}
+
+func ClientIP(r *http.Request) string {
+	if trustProxyHeaders {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+		if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+			return strings.TrimSpace(realIP)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
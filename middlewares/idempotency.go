@@ -0,0 +1,133 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/idempotencyService"
+)
+
+const (
+	IdempotencyHeader = "Idempotency-Key"
+
+	maxIdempotentBodyBytes = 4 << 20
+)
+
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rw *recordingResponseWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingResponseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+// IdempotencyMiddleware stores the first response sent for each user and
+// Idempotency-Key and replays it for retries within window, so retried
+// requests are never charged twice. Must run after AuthMiddleware.
+func IdempotencyMiddleware(db *sql.DB, window time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimSpace(r.Header.Get(IdempotencyHeader))
+		if key == "" || r.Method == http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > 255 {
+			http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := CurrentUserID(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		// The body is read up front so its hash can tell a retry from a
+		// different request reusing the key.
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodyBytes))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		hash := sha256.Sum256(body)
+
+		record, replay, err := idempotencyService.Begin(db, userID, key, r.Method, r.URL.Path, hex.EncodeToString(hash[:]), window)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrIdempotencyInFlight):
+				http.Error(w, err.Error(), http.StatusConflict)
+			case errors.Is(err, models.ErrIdempotencyKeyReused):
+				http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			default:
+				log.Printf("Error reserving idempotency key: %v", err)
+				http.Error(w, "Failed to process idempotency key", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if replay {
+			if record.ResponseContentType != "" {
+				w.Header().Set("Content-Type", record.ResponseContentType)
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(record.ResponseStatus)
+			w.Write([]byte(record.ResponseBody))
+			return
+		}
+
+		recorder := &recordingResponseWriter{ResponseWriter: w}
+		defer func() {
+			// A panicking handler must not leave the key in progress
+			// until it expires.
+			if p := recover(); p != nil {
+				if err := idempotencyService.Release(db, record); err != nil {
+					log.Printf("Error releasing idempotency key: %v", err)
+				}
+				panic(p)
+			}
+		}()
+		next.ServeHTTP(recorder, r)
+
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		// Failures the client is expected to retry must not be replayed.
+		if recorder.status >= http.StatusInternalServerError || recorder.status == http.StatusTooManyRequests {
+			if err := idempotencyService.Release(db, record); err != nil {
+				log.Printf("Error releasing idempotency key: %v", err)
+			}
+			return
+		}
+		if err := idempotencyService.Complete(db, record, recorder.status, w.Header().Get("Content-Type"), recorder.body.Bytes()); err != nil {
+			log.Printf("Error storing idempotent response: %v", err)
+		}
+	})
+}
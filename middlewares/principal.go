@@ -0,0 +1,111 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+)
+
+const (
+	AuthMethodJWT    = "jwt"
+	AuthMethodAPIKey = "api_key"
+)
+
+// Principal is the authenticated caller, loaded once by AuthMiddleware.
+type Principal struct {
+	UserID     int64
+	Username   string
+	Roles      []string
+	Status     string
+	AuthMethod string
+	SessionID  string
+	// Scopes and APIKeyID are only set for API key requests.
+	Scopes   []string
+	APIKeyID int64
+}
+
+// HasScope reports whether an API key's scopes cover permission; requests
+// authenticated with a JWT are not limited by scopes.
+func (p *Principal) HasScope(permission string) bool {
+	if p.AuthMethod != AuthMethodAPIKey {
+		return true
+	}
+	for _, scope := range p.Scopes {
+		if models.ScopeGrants(scope, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission checks the principal's roles and, for API keys, its scopes.
+func (p *Principal) HasPermission(permission string) bool {
+	return models.HasPermission(p.Roles, permission) && p.HasScope(permission)
+}
+
+type principalContextKey struct{}
+
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, principal)
+}
+
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalContextKey{}).(*Principal)
+	return principal, ok
+}
+
+var errNoPrincipal = errors.New("unauthorized")
+
+// CurrentPrincipal returns the caller of a request that went through
+// AuthMiddleware.
+func CurrentPrincipal(r *http.Request) (*Principal, error) {
+	principal, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		return nil, errNoPrincipal
+	}
+	return principal, nil
+}
+
+func CurrentUserID(r *http.Request) (int64, error) {
+	principal, err := CurrentPrincipal(r)
+	if err != nil {
+		return 0, err
+	}
+	return principal.UserID, nil
+}
+
+// UserLoader returns the current account state and roles of a user, or
+// models.ErrUserNotFound.
+type UserLoader func(userID int64) (*models.User, []string, error)
+
+var userLoader UserLoader
+
+// SetUserLoader installs the lookup AuthMiddleware uses to build the
+// principal from the database rather than from possibly stale token claims.
+func SetUserLoader(load UserLoader) {
+	userLoader = load
+}
+
+// loadPrincipal fetches the user behind a token or key, refusing accounts
+// that are inactive or soft-deleted.
+func loadPrincipal(userID int64, authMethod string) (*Principal, error) {
+	if userLoader == nil {
+		return nil, errors.New("user loader not configured")
+	}
+	user, roles, err := userLoader(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.CanAuthenticate() {
+		return nil, models.ErrAccountDisabled
+	}
+	return &Principal{
+		UserID:     user.ID,
+		Username:   user.Username,
+		Roles:      roles,
+		Status:     user.Status,
+		AuthMethod: authMethod,
+	}, nil
+}
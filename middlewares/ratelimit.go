@@ -0,0 +1,80 @@
+package middlewares
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/rateLimitService"
+)
+
+// rateLimitSubject keys limits by API key, then user, then client address.
+// Overrides are looked up for the owning user in the first two cases.
+func rateLimitSubject(r *http.Request) (string, int64) {
+	if principal, ok := PrincipalFromContext(r.Context()); ok {
+		if principal.AuthMethod == AuthMethodAPIKey {
+			return "apikey:" + strconv.FormatInt(principal.APIKeyID, 10), principal.UserID
+		}
+		return "user:" + strconv.FormatInt(principal.UserID, 10), principal.UserID
+	}
+	return "ip:" + ClientIP(r), 0
+}
+
+func ceilSeconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
+
+// writeRateLimitHeaders sets the RateLimit-* headers. When several limits
+// apply to one request, the one closest to running out is reported.
+func writeRateLimitHeaders(w http.ResponseWriter, result *rateLimitService.Result) {
+	if current := w.Header().Get("RateLimit-Remaining"); current != "" {
+		if remaining, err := strconv.Atoi(current); err == nil && remaining < result.Remaining {
+			return
+		}
+	}
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit.Requests))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.FormatInt(ceilSeconds(result.Reset), 10))
+	w.Header().Set("RateLimit-Policy", strconv.Itoa(result.Limit.Requests)+";w="+strconv.FormatInt(ceilSeconds(result.Limit.Period), 10))
+}
+
+// EnforceRateLimit counts the request against scope and answers 429 when
+// the caller is over the limit; handlers use it for limits that depend on
+// the request body. Store errors are logged and the request is let through.
+func EnforceRateLimit(w http.ResponseWriter, r *http.Request, db *sql.DB, scope string) bool {
+	subject, userID := rateLimitSubject(r)
+	result, err := rateLimitService.Allow(db, scope, subject, userID)
+	if err != nil {
+		log.Printf("Error checking rate limit for %s: %v", scope, err)
+		return true
+	}
+	if result == nil {
+		return true
+	}
+
+	if !result.Allowed {
+		// The limit that refused the request is the one to report.
+		w.Header().Del("RateLimit-Remaining")
+		writeRateLimitHeaders(w, result)
+		w.Header().Set("Retry-After", strconv.FormatInt(ceilSeconds(result.RetryAfter), 10))
+		http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+		return false
+	}
+	writeRateLimitHeaders(w, result)
+	return true
+}
+
+// RateLimit applies the limit configured for scope. Placed after
+// AuthMiddleware it limits per user or API key, otherwise per client IP.
+func RateLimit(db *sql.DB, scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !EnforceRateLimit(w, r, db, scope) {
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+)
+
+func authorize(allowed func(principal *Principal) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, err := CurrentPrincipal(r)
+			if err != nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if !allowed(principal) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRole only lets through callers holding at least one of roles.
+// Must run after AuthMiddleware.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return authorize(func(principal *Principal) bool {
+		for _, role := range roles {
+			if models.HasRole(principal.Roles, role) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// RequirePermission only lets through callers whose roles grant permission
+// in models.RolePermissions and, for API keys, whose scopes cover it. Must
+// run after AuthMiddleware.
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return authorize(func(principal *Principal) bool {
+		return principal.HasPermission(permission)
+	})
+}
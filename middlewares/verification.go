@@ -0,0 +1,37 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+)
+
+// ErrorCodeEmailNotVerified is returned in the "code" field when a pending
+// user calls an endpoint that requires a verified address.
+const ErrorCodeEmailNotVerified = "email_not_verified"
+
+// RequireVerifiedEmail rejects users whose address is still pending
+// verification. AuthMiddleware loads the status from the database, so
+// verifying takes effect without a new token. Must run after AuthMiddleware.
+func RequireVerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := CurrentPrincipal(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if principal.Status == models.StatusPendingVerification {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{
+				"code":  ErrorCodeEmailNotVerified,
+				"error": "Verify your email address before using this endpoint",
+			})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
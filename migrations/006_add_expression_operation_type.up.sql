@@ -0,0 +1 @@
+ALTER TABLE operations MODIFY type ENUM('addition', 'subtraction', 'multiplication', 'division', 'square_root', 'random_string', 'expression') NOT NULL;
@@ -0,0 +1,3 @@
+INSERT INTO operations (type, cost, status) VALUES
+    ('expression', 0.0, 'active')
+ON DUPLICATE KEY UPDATE cost = VALUES(cost), status = VALUES(status);
@@ -0,0 +1 @@
+ALTER TABLE operations MODIFY type VARCHAR(64) NOT NULL;
@@ -0,0 +1,16 @@
+CREATE TABLE idempotency_keys (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    method VARCHAR(10) NOT NULL,
+    path VARCHAR(255) NOT NULL,
+    status ENUM('in_progress', 'completed') NOT NULL DEFAULT 'in_progress',
+    response_status INT NULL,
+    response_content_type VARCHAR(100) NULL,
+    response_body MEDIUMTEXT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    UNIQUE KEY uq_idempotency_user_key (user_id, idempotency_key),
+    INDEX idx_idempotency_expires_at (expires_at),
+    CONSTRAINT fk_user_id_idempotency FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,18 @@
+CREATE TABLE ledger_entries (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    transaction_id VARCHAR(64) NOT NULL,
+    account VARCHAR(64) NOT NULL,
+    user_id INT NULL,
+    entry_type ENUM('opening_balance', 'top_up', 'debit', 'refund', 'adjustment') NOT NULL,
+    amount FLOAT NOT NULL,
+    balance_after FLOAT NULL,
+    reason VARCHAR(255) NOT NULL,
+    record_id INT NULL,
+    admin_id INT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_ledger_transaction_id (transaction_id),
+    INDEX idx_ledger_account_user (account, user_id, id),
+    CONSTRAINT fk_user_id_ledger FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_record_id_ledger FOREIGN KEY (record_id) REFERENCES records(id) ON DELETE SET NULL,
+    CONSTRAINT fk_admin_id_ledger FOREIGN KEY (admin_id) REFERENCES users(id) ON DELETE SET NULL
+);
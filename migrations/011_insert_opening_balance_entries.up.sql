@@ -0,0 +1,4 @@
+INSERT INTO ledger_entries (transaction_id, account, user_id, entry_type, amount, balance_after, reason)
+SELECT CONCAT('opening-', user_id), 'user_credits', user_id, 'opening_balance', credits, credits, 'Opening balance migrated from balances'
+FROM balances
+WHERE credits <> 0;
@@ -0,0 +1,4 @@
+INSERT INTO ledger_entries (transaction_id, account, user_id, entry_type, amount, reason)
+SELECT CONCAT('opening-', user_id), 'opening_balances', NULL, 'opening_balance', -credits, 'Opening balance migrated from balances'
+FROM balances
+WHERE credits <> 0;
@@ -0,0 +1 @@
+ALTER TABLE balances MODIFY credits DECIMAL(18,4) NOT NULL DEFAULT 0;
@@ -0,0 +1 @@
+ALTER TABLE operations MODIFY cost DECIMAL(18,4) NOT NULL;
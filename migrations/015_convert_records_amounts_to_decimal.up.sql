@@ -0,0 +1,3 @@
+ALTER TABLE records
+    MODIFY amount DECIMAL(18,4) NOT NULL,
+    MODIFY user_balance DECIMAL(18,4) NOT NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE ledger_entries
+    MODIFY amount DECIMAL(18,4) NOT NULL,
+    MODIFY balance_after DECIMAL(18,4) NULL;
@@ -0,0 +1,11 @@
+CREATE TABLE operation_price_history (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    operation_id INT NOT NULL,
+    old_cost DECIMAL(18,4) NULL,
+    new_cost DECIMAL(18,4) NOT NULL,
+    changed_by INT NULL,
+    effective_from TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_price_history_operation (operation_id, effective_from),
+    CONSTRAINT fk_operation_id_price_history FOREIGN KEY (operation_id) REFERENCES operations(id) ON DELETE CASCADE,
+    CONSTRAINT fk_changed_by_price_history FOREIGN KEY (changed_by) REFERENCES users(id) ON DELETE SET NULL
+);
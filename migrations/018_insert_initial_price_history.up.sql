@@ -0,0 +1,3 @@
+INSERT INTO operation_price_history (operation_id, old_cost, new_cost, changed_by)
+SELECT id, NULL, cost, NULL
+FROM operations;
@@ -0,0 +1,7 @@
+CREATE TABLE user_roles (
+    user_id INT NOT NULL,
+    role VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, role),
+    CONSTRAINT fk_user_id_roles FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
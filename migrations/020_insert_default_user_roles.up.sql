@@ -0,0 +1,3 @@
+INSERT INTO user_roles (user_id, role)
+SELECT id, 'user'
+FROM users;
@@ -0,0 +1,11 @@
+CREATE TABLE sessions (
+    id CHAR(32) PRIMARY KEY,
+    user_id INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_activity_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    idle_expires_at TIMESTAMP NOT NULL,
+    absolute_expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP NULL DEFAULT NULL,
+    INDEX idx_sessions_user (user_id),
+    CONSTRAINT fk_user_id_sessions FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
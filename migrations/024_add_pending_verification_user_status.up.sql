@@ -0,0 +1 @@
+ALTER TABLE users MODIFY status ENUM('active', 'inactive', 'pending_verification') DEFAULT 'active';
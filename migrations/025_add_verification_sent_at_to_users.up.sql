@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN verification_sent_at TIMESTAMP NULL DEFAULT NULL;
@@ -0,0 +1,9 @@
+CREATE TABLE login_failures (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    username VARCHAR(255) NOT NULL,
+    ip_address VARCHAR(45) NOT NULL,
+    reason VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_login_failures_username (username, created_at),
+    INDEX idx_login_failures_ip (ip_address, created_at)
+);
@@ -0,0 +1,7 @@
+CREATE TABLE login_throttles (
+    throttle_key VARCHAR(300) PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP NULL DEFAULT NULL,
+    locked_until TIMESTAMP NULL DEFAULT NULL,
+    INDEX idx_login_throttles_locked_until (locked_until)
+);
@@ -0,0 +1,8 @@
+CREATE TABLE user_mfa (
+    user_id INT PRIMARY KEY,
+    secret VARCHAR(64) NOT NULL,
+    enabled_at TIMESTAMP NULL DEFAULT NULL,
+    last_used_step BIGINT NULL DEFAULT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_user_id_user_mfa FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
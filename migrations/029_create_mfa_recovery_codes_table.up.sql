@@ -0,0 +1,9 @@
+CREATE TABLE mfa_recovery_codes (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    code_hash CHAR(64) NOT NULL,
+    used_at TIMESTAMP NULL DEFAULT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_mfa_recovery_codes_user (user_id),
+    CONSTRAINT fk_user_id_mfa_recovery_codes FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,5 @@
+CREATE TABLE rate_limit_buckets (
+    bucket_key VARCHAR(255) PRIMARY KEY,
+    tokens DOUBLE NOT NULL DEFAULT 0,
+    updated_at_micros BIGINT NOT NULL DEFAULT 0
+);
@@ -0,0 +1,10 @@
+CREATE TABLE rate_limit_overrides (
+    user_id INT NOT NULL,
+    scope VARCHAR(64) NOT NULL,
+    requests INT NOT NULL,
+    period_seconds INT NOT NULL,
+    updated_by INT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, scope),
+    CONSTRAINT fk_user_id_rate_limit_overrides FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+ALTER TABLE balances
+    ADD COLUMN held_credits DECIMAL(18,4) NOT NULL DEFAULT 0;
@@ -0,0 +1,24 @@
+CREATE TABLE jobs (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    operation_id INT NOT NULL,
+    operation_type VARCHAR(64) NOT NULL,
+    operands TEXT NOT NULL,
+    status ENUM('queued', 'running', 'succeeded', 'failed') NOT NULL DEFAULT 'queued',
+    hold_amount DECIMAL(18,4) NOT NULL,
+    hold_status ENUM('held', 'captured', 'released') NOT NULL DEFAULT 'held',
+    result TEXT NULL,
+    error VARCHAR(512) NULL,
+    record_id INT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    lease_token CHAR(32) NULL,
+    lease_expires_at TIMESTAMP NULL DEFAULT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP NULL DEFAULT NULL,
+    finished_at TIMESTAMP NULL DEFAULT NULL,
+    INDEX idx_jobs_status_lease (status, lease_expires_at),
+    INDEX idx_jobs_user (user_id, id),
+    CONSTRAINT fk_user_id_jobs FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_operation_id_jobs FOREIGN KEY (operation_id) REFERENCES operations(id),
+    CONSTRAINT fk_record_id_jobs FOREIGN KEY (record_id) REFERENCES records(id) ON DELETE SET NULL
+);
@@ -0,0 +1,9 @@
+INSERT INTO operations (type, cost, status) VALUES
+    ('random_integer', 20.0, 'active'),
+    ('random_float', 20.0, 'active'),
+    ('dice_roll', 20.0, 'active'),
+    ('shuffle', 30.0, 'active'),
+    ('weighted_choice', 20.0, 'active'),
+    ('uuid', 10.0, 'active'),
+    ('password', 50.0, 'active')
+ON DUPLICATE KEY UPDATE cost = VALUES(cost), status = VALUES(status);
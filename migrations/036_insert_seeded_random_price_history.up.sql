@@ -0,0 +1,4 @@
+INSERT INTO operation_price_history (operation_id, old_cost, new_cost, changed_by)
+SELECT id, NULL, cost, NULL
+FROM operations
+WHERE type IN ('random_integer', 'random_float', 'dice_roll', 'shuffle', 'weighted_choice', 'uuid', 'password');
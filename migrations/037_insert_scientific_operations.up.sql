@@ -0,0 +1,25 @@
+INSERT INTO operations (type, cost, status) VALUES
+    ('power', 30.0, 'active'),
+    ('nth_root', 30.0, 'active'),
+    ('log', 30.0, 'active'),
+    ('ln', 25.0, 'active'),
+    ('log10', 25.0, 'active'),
+    ('exp', 25.0, 'active'),
+    ('sin', 30.0, 'active'),
+    ('cos', 30.0, 'active'),
+    ('tan', 30.0, 'active'),
+    ('asin', 30.0, 'active'),
+    ('acos', 30.0, 'active'),
+    ('atan', 30.0, 'active'),
+    ('sinh', 35.0, 'active'),
+    ('cosh', 35.0, 'active'),
+    ('tanh', 35.0, 'active'),
+    ('asinh', 35.0, 'active'),
+    ('acosh', 35.0, 'active'),
+    ('atanh', 35.0, 'active'),
+    ('abs', 10.0, 'active'),
+    ('floor', 10.0, 'active'),
+    ('ceil', 10.0, 'active'),
+    ('round', 10.0, 'active'),
+    ('modulo', 20.0, 'active')
+ON DUPLICATE KEY UPDATE cost = VALUES(cost), status = VALUES(status);
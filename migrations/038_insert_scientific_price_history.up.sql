@@ -0,0 +1,5 @@
+INSERT INTO operation_price_history (operation_id, old_cost, new_cost, changed_by)
+SELECT id, NULL, cost, NULL
+FROM operations
+WHERE type IN ('power', 'nth_root', 'log', 'ln', 'log10', 'exp', 'sin', 'cos', 'tan', 'asin', 'acos', 'atan',
+    'sinh', 'cosh', 'tanh', 'asinh', 'acosh', 'atanh', 'abs', 'floor', 'ceil', 'round', 'modulo');
@@ -0,0 +1,2 @@
+ALTER TABLE idempotency_keys
+    ADD COLUMN request_hash CHAR(64) NOT NULL DEFAULT '';
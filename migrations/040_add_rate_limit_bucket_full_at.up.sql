@@ -0,0 +1,3 @@
+ALTER TABLE rate_limit_buckets
+    ADD COLUMN full_at_micros BIGINT NOT NULL DEFAULT 0,
+    ADD INDEX idx_rate_limit_buckets_full_at (full_at_micros);
@@ -7,38 +7,82 @@ import (
 )
 
 type User struct {
-	ID       int64
-	Username string
-	Password string
-	Status   string
+	ID        int64
+	Username  string
+	Password  string
+	Status    string
+	DeletedAt *time.Time
+}
+
+// CanAuthenticate reports whether the account may log in or use its tokens.
+func (u *User) CanAuthenticate() bool {
+	return u.DeletedAt == nil && u.Status != StatusInactive
 }
 
 const (
-	StatusActive   = "active"
-	StatusInactive = "inactive"
+	StatusActive              = "active"
+	StatusInactive            = "inactive"
+	StatusPendingVerification = "pending_verification"
 )
 
 type Balance struct {
 	ID      int64
 	UserID  int64
-	Credits float64
+	Credits Money
 }
 
 type Record struct {
 	ID                int64     `json:"id"`
 	OperationName     string    `json:"operation_name"`
 	UserID            int64     `json:"user_id"`
-	Amount            float64   `json:"amount"`
-	UserBalance       float64   `json:"user_balance"`
+	Amount            Money     `json:"amount"`
+	UserBalance       Money     `json:"user_balance"`
 	OperationResponse string    `json:"operation_response"`
 	Date              time.Time `json:"date"`
 }
 
+type LedgerEntry struct {
+	ID            int64     `json:"id"`
+	TransactionID string    `json:"transaction_id"`
+	Account       string    `json:"account"`
+	UserID        *int64    `json:"user_id,omitempty"`
+	Type          string    `json:"type"`
+	Amount        Money     `json:"amount"`
+	BalanceAfter  *Money    `json:"balance_after,omitempty"`
+	Reason        string    `json:"reason"`
+	RecordID      *int64    `json:"record_id,omitempty"`
+	AdminID       *int64    `json:"admin_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+const (
+	LedgerOpeningBalance = "opening_balance"
+	LedgerTopUp          = "top_up"
+	LedgerDebit          = "debit"
+	LedgerRefund         = "refund"
+	LedgerAdjustment     = "adjustment"
+)
+
+const (
+	LedgerAccountUserCredits       = "user_credits"
+	LedgerAccountTopUps            = "top_ups"
+	LedgerAccountOperationsRevenue = "operations_revenue"
+	LedgerAccountAdjustments       = "adjustments"
+)
+
+type LedgerPage struct {
+	TotalRecords   int           `json:"total_records"`
+	CurrentPage    int           `json:"current_page"`
+	TotalPages     int           `json:"total_pages"`
+	RecordsPerPage int           `json:"records_per_page"`
+	Entries        []LedgerEntry `json:"entries"`
+}
+
 type Operation struct {
 	ID     int64
 	Type   string
 	Status string
-	Cost   float64
+	Cost   Money
 }
 
 const (
@@ -48,8 +92,61 @@ const (
 	OperationDivision       = "division"
 	OperationSquareRoot     = "square_root"
 	OperationRandomString   = "random_string"
+	OperationExpression     = "expression"
+	OperationRandomInteger  = "random_integer"
+	OperationRandomFloat    = "random_float"
+	OperationDiceRoll       = "dice_roll"
+	OperationShuffle        = "shuffle"
+	OperationWeightedChoice = "weighted_choice"
+	OperationUUID           = "uuid"
+	OperationPassword       = "password"
+	OperationPower          = "power"
+	OperationNthRoot        = "nth_root"
+	OperationLog            = "log"
+	OperationLn             = "ln"
+	OperationLog10          = "log10"
+	OperationExp            = "exp"
+	OperationSin            = "sin"
+	OperationCos            = "cos"
+	OperationTan            = "tan"
+	OperationAsin           = "asin"
+	OperationAcos           = "acos"
+	OperationAtan           = "atan"
+	OperationSinh           = "sinh"
+	OperationCosh           = "cosh"
+	OperationTanh           = "tanh"
+	OperationAsinh          = "asinh"
+	OperationAcosh          = "acosh"
+	OperationAtanh          = "atanh"
+	OperationAbs            = "abs"
+	OperationFloor          = "floor"
+	OperationCeil           = "ceil"
+	OperationRound          = "round"
+	OperationModulo         = "modulo"
 )
 
+type OperationPriceChange struct {
+	ID            int64     `json:"id"`
+	OperationID   int64     `json:"operation_id"`
+	OldCost       *Money    `json:"old_cost"`
+	NewCost       Money     `json:"new_cost"`
+	ChangedBy     *int64    `json:"changed_by"`
+	EffectiveFrom time.Time `json:"effective_from"`
+}
+
+type OperationParam struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Required bool   `json:"required"`
+}
+
+type OperationInfo struct {
+	Operation
+	Arity      int              `json:"arity"`
+	Params     []OperationParam `json:"params"`
+	ResultType string           `json:"result_type"`
+}
+
 type ActionType string
 
 const (
@@ -81,7 +178,160 @@ type Credentials struct {
 	Password string `json:"password"`
 }
 
-var ErrRecordNotFound = errors.New("record not found")
+type RefreshToken struct {
+	ID        int64
+	UserID    int64
+	FamilyID  string
+	ExpiresAt time.Time
+	RotatedAt *time.Time
+	RevokedAt *time.Time
+}
+
+type Session struct {
+	ID                string
+	UserID            int64
+	CreatedAt         time.Time
+	LastActivityAt    time.Time
+	IdleExpiresAt     time.Time
+	AbsoluteExpiresAt time.Time
+	RevokedAt         *time.Time
+}
+
+type PasswordResetToken struct {
+	ID        int64
+	UserID    int64
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+type UserMFA struct {
+	UserID       int64
+	Secret       string
+	EnabledAt    *time.Time
+	LastUsedStep *int64
+}
+
+// APIKey is a long-lived credential for scripts. The secret itself is never
+// stored; Prefix identifies the key in listings.
+type APIKey struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP *string    `json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Job is an operation queued with ?async=true. Its cost is held on the
+// user's balance until a worker captures or releases it.
+type Job struct {
+	ID             int64      `json:"id"`
+	UserID         int64      `json:"user_id"`
+	OperationID    int64      `json:"-"`
+	OperationType  string     `json:"operation_type"`
+	Operands       string     `json:"-"`
+	Status         string     `json:"status"`
+	HoldAmount     Money      `json:"cost"`
+	HoldStatus     string     `json:"hold_status"`
+	Result         *string    `json:"-"`
+	Error          *string    `json:"error,omitempty"`
+	RecordID       *int64     `json:"record_id,omitempty"`
+	Attempts       int        `json:"attempts"`
+	LeaseToken     string     `json:"-"`
+	LeaseExpiresAt *time.Time `json:"-"`
+	CreatedAt      time.Time  `json:"created_at"`
+	StartedAt      *time.Time `json:"started_at,omitempty"`
+	FinishedAt     *time.Time `json:"finished_at,omitempty"`
+}
+
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+const (
+	HoldHeld     = "held"
+	HoldCaptured = "captured"
+	HoldReleased = "released"
+)
+
+// RateLimitOverride replaces the configured limit of one scope for a user;
+// Requests of 0 means unlimited.
+type RateLimitOverride struct {
+	UserID        int64  `json:"user_id"`
+	Scope         string `json:"scope"`
+	Requests      int    `json:"requests"`
+	PeriodSeconds int    `json:"period_seconds"`
+}
+
+// LoginThrottle tracks failed logins for one key ("user:<name>" or
+// "ip:<address>"); attempts are refused until LockedUntil.
+type LoginThrottle struct {
+	Key           string    `json:"key"`
+	Failures      int       `json:"failures"`
+	LastFailureAt time.Time `json:"last_failure_at"`
+	LockedUntil   time.Time `json:"locked_until"`
+}
+
+const (
+	LoginFailureInvalidCredentials = "invalid_credentials"
+	LoginFailureLocked             = "locked"
+)
+
+type IdempotencyRecord struct {
+	ID                  int64
+	UserID              int64
+	Key                 string
+	Method              string
+	Path                string
+	RequestHash         string
+	Status              string
+	ResponseStatus      int
+	ResponseContentType string
+	ResponseBody        string
+	ExpiresAt           time.Time
+}
+
+const (
+	IdempotencyInProgress = "in_progress"
+	IdempotencyCompleted  = "completed"
+)
+
+var (
+	ErrRecordNotFound       = errors.New("record not found")
+	ErrInsufficientCredits  = errors.New("insufficient credits")
+	ErrMoneyOutOfRange      = errors.New("amount is out of range")
+	ErrInvalidAmount        = errors.New("amount must be greater than zero")
+	ErrOperationNotFound    = errors.New("operation not found")
+	ErrOperationInactive    = errors.New("operation is not available")
+	ErrOperationExists      = errors.New("operation already exists")
+	ErrUserNotFound         = errors.New("user not found")
+	ErrAccountDisabled      = errors.New("account is disabled")
+	ErrInvalidRefreshToken  = errors.New("invalid refresh token")
+	ErrRefreshTokenReused   = errors.New("refresh token reuse detected")
+	ErrSessionExpired       = errors.New("session expired")
+	ErrInvalidResetToken    = errors.New("invalid or expired password reset token")
+	ErrPasswordTooShort     = errors.New("password must be at least 8 characters")
+	ErrInvalidVerification  = errors.New("invalid or expired verification link")
+	ErrAlreadyVerified      = errors.New("email address is already verified")
+	ErrMFANotEnrolled       = errors.New("two-factor authentication is not enabled")
+	ErrMFAAlreadyEnabled    = errors.New("two-factor authentication is already enabled")
+	ErrInvalidMFACode       = errors.New("invalid authentication code")
+	ErrInvalidMFAChallenge  = errors.New("invalid or expired MFA challenge")
+	ErrInvalidAPIKey        = errors.New("invalid API key")
+	ErrAPIKeyNotFound       = errors.New("API key not found")
+	ErrOverrideNotFound     = errors.New("rate limit override not found")
+	ErrJobNotFound          = errors.New("job not found")
+	ErrJobLeaseLost         = errors.New("job lease was lost")
+	ErrIdempotencyInFlight  = errors.New("a request with this idempotency key is still in progress")
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different request")
+)
 
 var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
 
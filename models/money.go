@@ -0,0 +1,195 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Money is an exact amount of credits stored as ten-thousandths of a credit,
+// matching the DECIMAL(18,4) columns it is persisted in.
+type Money int64
+
+const (
+	MoneyDigits   = 18
+	MoneyDecimals = 4
+	MoneyScale    = 10000
+
+	// MaxMoney is 99999999999999.9999, the largest DECIMAL(18,4) value.
+	MaxMoney Money = 999999999999999999
+)
+
+var moneyAsNumber atomic.Bool
+
+// SetMoneyJSONNumeric switches Money JSON encoding back to plain numbers for
+// clients that still expect the old float format.
+func SetMoneyJSONNumeric(enabled bool) {
+	moneyAsNumber.Store(enabled)
+}
+
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+
+	negative := false
+	switch s[0] {
+	case '-':
+		negative = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	whole, fraction, _ := strings.Cut(s, ".")
+	if whole == "" && fraction == "" {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if len(fraction) > MoneyDecimals {
+		trimmed := strings.TrimRight(fraction[MoneyDecimals:], "0")
+		if trimmed != "" {
+			return 0, fmt.Errorf("amount %q has more than %d decimal places", s, MoneyDecimals)
+		}
+		fraction = fraction[:MoneyDecimals]
+	}
+	fraction += strings.Repeat("0", MoneyDecimals-len(fraction))
+	if whole == "" {
+		whole = "0"
+	}
+
+	for _, c := range whole + fraction {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("invalid amount %q", s)
+		}
+	}
+
+	whole = strings.TrimLeft(whole, "0")
+	if len(whole) > MoneyDigits-MoneyDecimals {
+		return 0, fmt.Errorf("%w: %q", ErrMoneyOutOfRange, s)
+	}
+	units, _ := strconv.ParseInt("0"+whole, 10, 64)
+	minor, _ := strconv.ParseInt(fraction, 10, 64)
+
+	value := Money(units*MoneyScale + minor)
+	if negative {
+		value = -value
+	}
+	return value, nil
+}
+
+func MoneyFromFloat(f float64) Money {
+	return Money(math.Round(f * MoneyScale))
+}
+
+func (m Money) Float64() float64 {
+	return float64(m) / MoneyScale
+}
+
+func (m Money) inRange() bool {
+	return m >= -MaxMoney && m <= MaxMoney
+}
+
+// Add returns m + n, or ErrMoneyOutOfRange when the sum does not fit the
+// DECIMAL(18,4) columns.
+func (m Money) Add(n Money) (Money, error) {
+	if !m.inRange() || !n.inRange() || !(m + n).inRange() {
+		return 0, ErrMoneyOutOfRange
+	}
+	return m + n, nil
+}
+
+// Mul returns m * n, or ErrMoneyOutOfRange when the product overflows or
+// does not fit the DECIMAL(18,4) columns.
+func (m Money) Mul(n int64) (Money, error) {
+	if m == 0 || n == 0 {
+		return 0, nil
+	}
+	product := m * Money(n)
+	if product/Money(n) != m || !product.inRange() {
+		return 0, ErrMoneyOutOfRange
+	}
+	return product, nil
+}
+
+// String formats m as an exact decimal without trailing zeros, e.g. "0.3".
+func (m Money) String() string {
+	sign := ""
+	value := int64(m)
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+	whole := value / MoneyScale
+	fraction := value % MoneyScale
+	if fraction == 0 {
+		return sign + strconv.FormatInt(whole, 10)
+	}
+	digits := strings.TrimRight(fmt.Sprintf("%0*d", MoneyDecimals, fraction), "0")
+	return fmt.Sprintf("%s%d.%s", sign, whole, digits)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	if moneyAsNumber.Load() {
+		return []byte(m.String()), nil
+	}
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON accepts both decimal strings and JSON numbers, parsing the
+// literal digits so no float rounding is involved.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+	if strings.HasPrefix(text, `"`) {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+	}
+	value, err := ParseMoney(text)
+	if err != nil {
+		return err
+	}
+	*m = value
+	return nil
+}
+
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+		return nil
+	case []byte:
+		value, err := ParseMoney(string(v))
+		if err != nil {
+			return err
+		}
+		*m = value
+		return nil
+	case string:
+		value, err := ParseMoney(v)
+		if err != nil {
+			return err
+		}
+		*m = value
+		return nil
+	case int64:
+		*m = Money(v * MoneyScale)
+		return nil
+	case float64:
+		*m = MoneyFromFloat(v)
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
@@ -0,0 +1,91 @@
+package models
+
+import "strings"
+
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+const (
+	PermOperationsPerform = "operations:perform"
+	PermOperationsManage  = "operations:manage"
+	PermRecordsReadOwn    = "records:read:own"
+	PermRecordsReadAny    = "records:read:any"
+	PermRecordsDeleteOwn  = "records:delete:own"
+	PermLedgerReadOwn     = "ledger:read:own"
+	PermLedgerReadAny     = "ledger:read:any"
+	PermCreditsManageOwn  = "credits:manage:own"
+	PermCreditsGrant      = "credits:grant"
+	PermUsersManage       = "users:manage"
+)
+
+var userPermissions = []string{
+	PermOperationsPerform,
+	PermRecordsReadOwn,
+	PermRecordsDeleteOwn,
+	PermLedgerReadOwn,
+	PermCreditsManageOwn,
+}
+
+// RolePermissions is the permission matrix: support staff can inspect any
+// user's history but cannot move credits or change the catalog.
+var RolePermissions = map[string][]string{
+	RoleUser: userPermissions,
+	RoleSupport: append([]string{
+		PermRecordsReadAny,
+		PermLedgerReadAny,
+	}, userPermissions...),
+	RoleAdmin: append([]string{
+		PermRecordsReadAny,
+		PermLedgerReadAny,
+		PermOperationsManage,
+		PermCreditsGrant,
+		PermUsersManage,
+	}, userPermissions...),
+}
+
+func IsValidRole(role string) bool {
+	_, ok := RolePermissions[role]
+	return ok
+}
+
+func HasRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func HasPermission(roles []string, permission string) bool {
+	for _, role := range roles {
+		for _, p := range RolePermissions[role] {
+			if p == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ScopeGrants reports whether an API key scope covers permission. A scope
+// names a permission or a prefix of one, so "records:read" covers both
+// "records:read:own" and "records:read:any".
+func ScopeGrants(scope, permission string) bool {
+	return scope == permission || strings.HasPrefix(permission, scope+":")
+}
+
+// IsValidScope accepts scopes covering at least one known permission.
+func IsValidScope(scope string) bool {
+	for _, permissions := range RolePermissions {
+		for _, p := range permissions {
+			if ScopeGrants(scope, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
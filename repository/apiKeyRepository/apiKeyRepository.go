@@ -0,0 +1,93 @@
+package apiKeyRepository
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository"
+)
+
+const apiKeyColumns = "id, user_id, name, prefix, scopes, expires_at, last_used_at, last_used_ip, revoked_at, created_at"
+
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (*models.APIKey, error) {
+	var key models.APIKey
+	var scopes string
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	var lastUsedIP sql.NullString
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &scopes, &expiresAt, &lastUsedAt, &lastUsedIP, &revokedAt, &key.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	key.Scopes = []string{}
+	if scopes != "" {
+		key.Scopes = strings.Split(scopes, ",")
+	}
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if lastUsedIP.Valid {
+		key.LastUsedIP = &lastUsedIP.String
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return &key, nil
+}
+
+func CreateAPIKey(db repository.Executor, key *models.APIKey, keyHash string) (int64, error) {
+	result, err := db.Exec(
+		"INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		key.UserID, key.Name, key.Prefix, keyHash, strings.Join(key.Scopes, ","), key.ExpiresAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func GetAPIKeyByHash(db repository.Executor, keyHash string) (*models.APIKey, error) {
+	return scanAPIKey(db.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = ?", keyHash))
+}
+
+func GetUserAPIKeys(db repository.Executor, userID int64) ([]models.APIKey, error) {
+	rows, err := db.Query("SELECT "+apiKeyColumns+" FROM api_keys WHERE user_id = ? ORDER BY created_at DESC, id DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+func TouchAPIKey(db repository.Executor, keyID int64, usedAt time.Time, ip string) error {
+	_, err := db.Exec("UPDATE api_keys SET last_used_at = ?, last_used_ip = ? WHERE id = ?", usedAt, ip, keyID)
+	return err
+}
+
+// RevokeAPIKey reports whether an active key of the user was revoked.
+func RevokeAPIKey(db repository.Executor, userID, keyID int64, revokedAt time.Time) (bool, error) {
+	result, err := db.Exec("UPDATE api_keys SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL", revokedAt, keyID, userID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func RevokeUserAPIKeys(db repository.Executor, userID int64, revokedAt time.Time) error {
+	_, err := db.Exec("UPDATE api_keys SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", revokedAt, userID)
+	return err
+}
@@ -0,0 +1,69 @@
+package idempotencyRepository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository"
+)
+
+// ErrKeyExists is returned by Reserve when the user already used the key.
+var ErrKeyExists = errors.New("idempotency key already exists")
+
+func Reserve(db repository.Executor, userID int64, key, method, path, requestHash string, expiresAt time.Time) (int64, error) {
+	result, err := db.Exec(`
+		INSERT INTO idempotency_keys (user_id, idempotency_key, method, path, request_hash, status, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		userID, key, method, path, requestHash, models.IdempotencyInProgress, expiresAt,
+	)
+	if err != nil {
+		if repository.IsDuplicateEntry(err) {
+			return 0, ErrKeyExists
+		}
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func GetByKey(db repository.Executor, userID int64, key string) (*models.IdempotencyRecord, error) {
+	var record models.IdempotencyRecord
+	var responseStatus sql.NullInt64
+	var contentType, body sql.NullString
+	err := db.QueryRow(`
+		SELECT id, user_id, idempotency_key, method, path, request_hash, status, response_status, response_content_type, response_body, expires_at
+		FROM idempotency_keys WHERE user_id = ? AND idempotency_key = ?`, userID, key).
+		Scan(&record.ID, &record.UserID, &record.Key, &record.Method, &record.Path, &record.RequestHash, &record.Status,
+			&responseStatus, &contentType, &body, &record.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	record.ResponseStatus = int(responseStatus.Int64)
+	record.ResponseContentType = contentType.String
+	record.ResponseBody = body.String
+	return &record, nil
+}
+
+func Complete(db repository.Executor, id int64, responseStatus int, contentType string, body []byte) error {
+	_, err := db.Exec(`
+		UPDATE idempotency_keys
+		SET status = ?, response_status = ?, response_content_type = ?, response_body = ?
+		WHERE id = ?`,
+		models.IdempotencyCompleted, responseStatus, contentType, string(body), id,
+	)
+	return err
+}
+
+func Delete(db repository.Executor, id int64) error {
+	_, err := db.Exec("DELETE FROM idempotency_keys WHERE id = ?", id)
+	return err
+}
+
+func DeleteExpired(db repository.Executor, now time.Time) (int64, error) {
+	result, err := db.Exec("DELETE FROM idempotency_keys WHERE expires_at < ?", now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,110 @@
+package jobRepository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository"
+)
+
+const jobColumns = "id, user_id, operation_id, operation_type, operands, status, hold_amount, hold_status, result, error, record_id, attempts, lease_token, lease_expires_at, created_at, started_at, finished_at"
+
+func scanJob(row interface{ Scan(...interface{}) error }) (*models.Job, error) {
+	var job models.Job
+	var result, errorMessage, leaseToken sql.NullString
+	var recordID sql.NullInt64
+	var leaseExpiresAt, startedAt, finishedAt sql.NullTime
+	err := row.Scan(&job.ID, &job.UserID, &job.OperationID, &job.OperationType, &job.Operands, &job.Status,
+		&job.HoldAmount, &job.HoldStatus, &result, &errorMessage, &recordID, &job.Attempts, &leaseToken,
+		&leaseExpiresAt, &job.CreatedAt, &startedAt, &finishedAt)
+	if err != nil {
+		return nil, err
+	}
+	if result.Valid {
+		job.Result = &result.String
+	}
+	if errorMessage.Valid {
+		job.Error = &errorMessage.String
+	}
+	if recordID.Valid {
+		job.RecordID = &recordID.Int64
+	}
+	job.LeaseToken = leaseToken.String
+	if leaseExpiresAt.Valid {
+		job.LeaseExpiresAt = &leaseExpiresAt.Time
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	return &job, nil
+}
+
+func CreateJob(db repository.Executor, job *models.Job) (int64, error) {
+	result, err := db.Exec(
+		"INSERT INTO jobs (user_id, operation_id, operation_type, operands, status, hold_amount, hold_status) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		job.UserID, job.OperationID, job.OperationType, job.Operands, models.JobQueued, job.HoldAmount, models.HoldHeld,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func GetJob(db repository.Executor, jobID int64) (*models.Job, error) {
+	job, err := scanJob(db.QueryRow("SELECT "+jobColumns+" FROM jobs WHERE id = ?", jobID))
+	if err == sql.ErrNoRows {
+		return nil, models.ErrJobNotFound
+	}
+	return job, err
+}
+
+// ClaimNext leases the oldest queued job, or a running job whose lease has
+// expired because its worker died, to the caller identified by token. It
+// returns sql.ErrNoRows when there is nothing to do.
+func ClaimNext(db repository.Executor, token string, now, leaseUntil time.Time) (*models.Job, error) {
+	result, err := db.Exec(`
+		UPDATE jobs
+		SET status = ?, lease_token = ?, lease_expires_at = ?, attempts = attempts + 1, started_at = COALESCE(started_at, ?)
+		WHERE status = ? OR (status = ? AND lease_expires_at < ?)
+		ORDER BY id
+		LIMIT 1`,
+		models.JobRunning, token, leaseUntil, now, models.JobQueued, models.JobRunning, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if claimed == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return scanJob(db.QueryRow("SELECT "+jobColumns+" FROM jobs WHERE lease_token = ? AND status = ?", token, models.JobRunning))
+}
+
+// Finish stores the outcome of a job, provided the caller still holds its
+// lease; otherwise models.ErrJobLeaseLost is returned.
+func Finish(db repository.Executor, job *models.Job, token string) error {
+	result, err := db.Exec(`
+		UPDATE jobs
+		SET status = ?, hold_status = ?, result = ?, error = ?, record_id = ?, lease_token = NULL, lease_expires_at = NULL, finished_at = ?
+		WHERE id = ? AND lease_token = ? AND status = ?`,
+		job.Status, job.HoldStatus, job.Result, job.Error, job.RecordID, job.FinishedAt, job.ID, token, models.JobRunning,
+	)
+	if err != nil {
+		return err
+	}
+	finished, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if finished == 0 {
+		return models.ErrJobLeaseLost
+	}
+	return nil
+}
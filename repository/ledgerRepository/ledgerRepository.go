@@ -0,0 +1,80 @@
+package ledgerRepository
+
+import (
+	"database/sql"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository"
+)
+
+func CreateEntry(db repository.Executor, entry *models.LedgerEntry) (int64, error) {
+	result, err := db.Exec(`
+		INSERT INTO ledger_entries (transaction_id, account, user_id, entry_type, amount, balance_after, reason, record_id, admin_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.TransactionID, entry.Account, entry.UserID, entry.Type, entry.Amount, entry.BalanceAfter,
+		entry.Reason, entry.RecordID, entry.AdminID, entry.CreatedAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func SumUserCredits(db repository.Executor, userID int64) (models.Money, error) {
+	var total models.Money
+	err := db.QueryRow(
+		"SELECT COALESCE(SUM(amount), 0) FROM ledger_entries WHERE account = ? AND user_id = ?",
+		models.LedgerAccountUserCredits, userID,
+	).Scan(&total)
+	return total, err
+}
+
+func GetUserEntries(db repository.Executor, userID int64, limit, offset int) ([]models.LedgerEntry, int, error) {
+	var total int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM ledger_entries WHERE account = ? AND user_id = ?",
+		models.LedgerAccountUserCredits, userID,
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(`
+		SELECT id, transaction_id, account, user_id, entry_type, amount, balance_after, reason, record_id, admin_id, created_at
+		FROM ledger_entries
+		WHERE account = ? AND user_id = ?
+		ORDER BY id DESC
+		LIMIT ? OFFSET ?`,
+		models.LedgerAccountUserCredits, userID, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []models.LedgerEntry{}
+	for rows.Next() {
+		var entry models.LedgerEntry
+		var entryUserID, recordID, adminID sql.NullInt64
+		var balanceAfter sql.Null[models.Money]
+		if err := rows.Scan(&entry.ID, &entry.TransactionID, &entry.Account, &entryUserID, &entry.Type, &entry.Amount,
+			&balanceAfter, &entry.Reason, &recordID, &adminID, &entry.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		if entryUserID.Valid {
+			entry.UserID = &entryUserID.Int64
+		}
+		if balanceAfter.Valid {
+			entry.BalanceAfter = &balanceAfter.V
+		}
+		if recordID.Valid {
+			entry.RecordID = &recordID.Int64
+		}
+		if adminID.Valid {
+			entry.AdminID = &adminID.Int64
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, total, rows.Err()
+}
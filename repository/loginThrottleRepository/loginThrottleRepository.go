@@ -0,0 +1,78 @@
+package loginThrottleRepository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository"
+)
+
+func InsertFailure(db repository.Executor, username, ipAddress, reason string) error {
+	_, err := db.Exec(
+		"INSERT INTO login_failures (username, ip_address, reason) VALUES (?, ?, ?)",
+		username, ipAddress, reason,
+	)
+	return err
+}
+
+func scanThrottle(row interface{ Scan(...interface{}) error }) (*models.LoginThrottle, error) {
+	var throttle models.LoginThrottle
+	var lastFailureAt, lockedUntil sql.NullTime
+	if err := row.Scan(&throttle.Key, &throttle.Failures, &lastFailureAt, &lockedUntil); err != nil {
+		return nil, err
+	}
+	throttle.LastFailureAt = lastFailureAt.Time
+	throttle.LockedUntil = lockedUntil.Time
+	return &throttle, nil
+}
+
+func GetThrottle(db repository.Executor, key string) (*models.LoginThrottle, error) {
+	return scanThrottle(db.QueryRow(
+		"SELECT throttle_key, failures, last_failure_at, locked_until FROM login_throttles WHERE throttle_key = ?", key,
+	))
+}
+
+// GetThrottleForUpdate locks the key's row, creating an empty one first so
+// concurrent failures for a new key serialize on the same row.
+func GetThrottleForUpdate(tx *sql.Tx, key string) (*models.LoginThrottle, error) {
+	if _, err := tx.Exec("INSERT IGNORE INTO login_throttles (throttle_key) VALUES (?)", key); err != nil {
+		return nil, err
+	}
+	return scanThrottle(tx.QueryRow(
+		"SELECT throttle_key, failures, last_failure_at, locked_until FROM login_throttles WHERE throttle_key = ? FOR UPDATE", key,
+	))
+}
+
+func SaveThrottle(db repository.Executor, throttle *models.LoginThrottle) error {
+	_, err := db.Exec(
+		"UPDATE login_throttles SET failures = ?, last_failure_at = ?, locked_until = ? WHERE throttle_key = ?",
+		throttle.Failures, throttle.LastFailureAt, throttle.LockedUntil, throttle.Key,
+	)
+	return err
+}
+
+func DeleteThrottle(db repository.Executor, key string) error {
+	_, err := db.Exec("DELETE FROM login_throttles WHERE throttle_key = ?", key)
+	return err
+}
+
+func GetLockedThrottles(db repository.Executor, now time.Time) ([]models.LoginThrottle, error) {
+	rows, err := db.Query(`
+		SELECT throttle_key, failures, last_failure_at, locked_until
+		FROM login_throttles WHERE locked_until > ? ORDER BY locked_until DESC`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	throttles := []models.LoginThrottle{}
+	for rows.Next() {
+		throttle, err := scanThrottle(rows)
+		if err != nil {
+			return nil, err
+		}
+		throttles = append(throttles, *throttle)
+	}
+	return throttles, rows.Err()
+}
@@ -0,0 +1,82 @@
+package mfaRepository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository"
+)
+
+func scanMFA(row *sql.Row) (*models.UserMFA, error) {
+	var mfa models.UserMFA
+	var enabledAt sql.NullTime
+	var lastUsedStep sql.NullInt64
+	if err := row.Scan(&mfa.UserID, &mfa.Secret, &enabledAt, &lastUsedStep); err != nil {
+		return nil, err
+	}
+	if enabledAt.Valid {
+		mfa.EnabledAt = &enabledAt.Time
+	}
+	if lastUsedStep.Valid {
+		mfa.LastUsedStep = &lastUsedStep.Int64
+	}
+	return &mfa, nil
+}
+
+func GetMFA(db repository.Executor, userID int64) (*models.UserMFA, error) {
+	return scanMFA(db.QueryRow("SELECT user_id, secret, enabled_at, last_used_step FROM user_mfa WHERE user_id = ?", userID))
+}
+
+func GetMFAForUpdate(tx *sql.Tx, userID int64) (*models.UserMFA, error) {
+	return scanMFA(tx.QueryRow("SELECT user_id, secret, enabled_at, last_used_step FROM user_mfa WHERE user_id = ? FOR UPDATE", userID))
+}
+
+// SavePendingSecret stores a new secret that is not active until Enable.
+func SavePendingSecret(db repository.Executor, userID int64, secret string) error {
+	_, err := db.Exec(`
+		INSERT INTO user_mfa (user_id, secret) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE secret = VALUES(secret), enabled_at = NULL, last_used_step = NULL`,
+		userID, secret,
+	)
+	return err
+}
+
+func Enable(db repository.Executor, userID int64, enabledAt time.Time) error {
+	_, err := db.Exec("UPDATE user_mfa SET enabled_at = ? WHERE user_id = ?", enabledAt, userID)
+	return err
+}
+
+func SetLastUsedStep(db repository.Executor, userID, step int64) error {
+	_, err := db.Exec("UPDATE user_mfa SET last_used_step = ? WHERE user_id = ?", step, userID)
+	return err
+}
+
+func DeleteMFA(db repository.Executor, userID int64) error {
+	_, err := db.Exec("DELETE FROM user_mfa WHERE user_id = ?", userID)
+	return err
+}
+
+func CreateRecoveryCode(db repository.Executor, userID int64, codeHash string) error {
+	_, err := db.Exec("INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, codeHash)
+	return err
+}
+
+// UseRecoveryCode marks an unused code as spent and reports whether one
+// matched.
+func UseRecoveryCode(db repository.Executor, userID int64, codeHash string, usedAt time.Time) (bool, error) {
+	result, err := db.Exec(
+		"UPDATE mfa_recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL LIMIT 1",
+		usedAt, userID, codeHash,
+	)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func DeleteRecoveryCodes(db repository.Executor, userID int64) error {
+	_, err := db.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID)
+	return err
+}
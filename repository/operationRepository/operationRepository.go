@@ -2,22 +2,122 @@ package operationRepository
 
 import (
 	"database/sql"
-	"errors"
+	"time"
 
 	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository"
 )
 
-func GetOperationFromDB(db *sql.DB, operationType string) (*models.Operation, error) {
+func GetOperationFromDB(db repository.Executor, operationType string) (*models.Operation, error) {
 	var operation models.Operation
 
-	err := db.QueryRow("SELECT id, type, cost, status FROM operations WHERE type = ? AND status = 'active'", operationType).
+	err := db.QueryRow("SELECT id, type, cost, status FROM operations WHERE type = ?", operationType).
 		Scan(&operation.ID, &operation.Type, &operation.Cost, &operation.Status)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("operation type not found or inactive")
+			return nil, models.ErrOperationNotFound
+		}
+		return nil, err
+	}
+	if operation.Status != models.StatusActive {
+		return nil, models.ErrOperationInactive
+	}
+
+	return &operation, nil
+}
+
+func GetOperationByIDForUpdate(tx *sql.Tx, operationID int64) (*models.Operation, error) {
+	var operation models.Operation
+
+	err := tx.QueryRow("SELECT id, type, cost, status FROM operations WHERE id = ? FOR UPDATE", operationID).
+		Scan(&operation.ID, &operation.Type, &operation.Cost, &operation.Status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, models.ErrOperationNotFound
 		}
 		return nil, err
 	}
 
 	return &operation, nil
 }
+
+func GetAllOperations(db repository.Executor) ([]models.Operation, error) {
+	query := "SELECT id, type, cost, status FROM operations ORDER BY type"
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var operations []models.Operation
+	for rows.Next() {
+		var operation models.Operation
+		if err := rows.Scan(&operation.ID, &operation.Type, &operation.Cost, &operation.Status); err != nil {
+			return nil, err
+		}
+		operations = append(operations, operation)
+	}
+
+	return operations, nil
+}
+
+func CreateOperation(db repository.Executor, operationType string, cost models.Money, status string) (int64, error) {
+	result, err := db.Exec("INSERT INTO operations (type, cost, status) VALUES (?, ?, ?)", operationType, cost, status)
+	if err != nil {
+		if repository.IsDuplicateEntry(err) {
+			return 0, models.ErrOperationExists
+		}
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func UpdateOperationCost(db repository.Executor, operationID int64, cost models.Money) error {
+	_, err := db.Exec("UPDATE operations SET cost = ? WHERE id = ?", cost, operationID)
+	return err
+}
+
+func UpdateOperationStatus(db repository.Executor, operationID int64, status string) error {
+	_, err := db.Exec("UPDATE operations SET status = ? WHERE id = ?", status, operationID)
+	return err
+}
+
+func CreatePriceChange(db repository.Executor, operationID int64, oldCost *models.Money, newCost models.Money, changedBy int64, effectiveFrom time.Time) error {
+	_, err := db.Exec(`
+		INSERT INTO operation_price_history (operation_id, old_cost, new_cost, changed_by, effective_from)
+		VALUES (?, ?, ?, ?, ?)`,
+		operationID, oldCost, newCost, changedBy, effectiveFrom,
+	)
+	return err
+}
+
+func GetPriceHistory(db repository.Executor, operationID int64) ([]models.OperationPriceChange, error) {
+	rows, err := db.Query(`
+		SELECT id, operation_id, old_cost, new_cost, changed_by, effective_from
+		FROM operation_price_history
+		WHERE operation_id = ?
+		ORDER BY effective_from DESC, id DESC`, operationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []models.OperationPriceChange{}
+	for rows.Next() {
+		var change models.OperationPriceChange
+		var oldCost sql.Null[models.Money]
+		var changedBy sql.NullInt64
+		if err := rows.Scan(&change.ID, &change.OperationID, &oldCost, &change.NewCost, &changedBy, &change.EffectiveFrom); err != nil {
+			return nil, err
+		}
+		if oldCost.Valid {
+			change.OldCost = &oldCost.V
+		}
+		if changedBy.Valid {
+			change.ChangedBy = &changedBy.Int64
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, rows.Err()
+}
@@ -0,0 +1,40 @@
+package passwordResetRepository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository"
+)
+
+func CreateToken(db repository.Executor, userID int64, tokenHash string, expiresAt time.Time) error {
+	_, err := db.Exec(
+		"INSERT INTO password_reset_tokens (user_id, token_hash, expires_at) VALUES (?, ?, ?)",
+		userID, tokenHash, expiresAt,
+	)
+	return err
+}
+
+func GetTokenByHashForUpdate(tx *sql.Tx, tokenHash string) (*models.PasswordResetToken, error) {
+	var token models.PasswordResetToken
+	var usedAt sql.NullTime
+	err := tx.QueryRow(`
+		SELECT id, user_id, expires_at, used_at
+		FROM password_reset_tokens WHERE token_hash = ? FOR UPDATE`, tokenHash).
+		Scan(&token.ID, &token.UserID, &token.ExpiresAt, &usedAt)
+	if err != nil {
+		return nil, err
+	}
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	return &token, nil
+}
+
+// MarkUserTokensUsed consumes every outstanding token of the user, so a
+// successful reset also invalidates links from earlier requests.
+func MarkUserTokensUsed(db repository.Executor, userID int64, usedAt time.Time) error {
+	_, err := db.Exec("UPDATE password_reset_tokens SET used_at = ? WHERE user_id = ? AND used_at IS NULL", usedAt, userID)
+	return err
+}
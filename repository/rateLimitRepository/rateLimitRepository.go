@@ -0,0 +1,74 @@
+package rateLimitRepository
+
+import (
+	"database/sql"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository"
+)
+
+// GetBucketForUpdate locks the bucket row, creating it first so concurrent
+// requests for a new key serialize on the same row. A new bucket has
+// updatedAtMicros 0.
+func GetBucketForUpdate(tx *sql.Tx, key string) (float64, int64, error) {
+	if _, err := tx.Exec("INSERT IGNORE INTO rate_limit_buckets (bucket_key) VALUES (?)", key); err != nil {
+		return 0, 0, err
+	}
+	var tokens float64
+	var updatedAtMicros int64
+	err := tx.QueryRow("SELECT tokens, updated_at_micros FROM rate_limit_buckets WHERE bucket_key = ? FOR UPDATE", key).
+		Scan(&tokens, &updatedAtMicros)
+	return tokens, updatedAtMicros, err
+}
+
+// SaveBucket stores a bucket along with the time it will have refilled
+// completely, after which DeleteFullBuckets may drop it.
+func SaveBucket(db repository.Executor, key string, tokens float64, updatedAtMicros, fullAtMicros int64) error {
+	_, err := db.Exec("UPDATE rate_limit_buckets SET tokens = ?, updated_at_micros = ?, full_at_micros = ? WHERE bucket_key = ?",
+		tokens, updatedAtMicros, fullAtMicros, key)
+	return err
+}
+
+func DeleteFullBuckets(db repository.Executor, nowMicros int64) (int64, error) {
+	result, err := db.Exec("DELETE FROM rate_limit_buckets WHERE full_at_micros <= ?", nowMicros)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func GetUserOverrides(db repository.Executor, userID int64) ([]models.RateLimitOverride, error) {
+	rows, err := db.Query("SELECT user_id, scope, requests, period_seconds FROM rate_limit_overrides WHERE user_id = ? ORDER BY scope", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	overrides := []models.RateLimitOverride{}
+	for rows.Next() {
+		var override models.RateLimitOverride
+		if err := rows.Scan(&override.UserID, &override.Scope, &override.Requests, &override.PeriodSeconds); err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, override)
+	}
+	return overrides, rows.Err()
+}
+
+func UpsertOverride(db repository.Executor, override *models.RateLimitOverride, adminID int64) error {
+	_, err := db.Exec(`
+		INSERT INTO rate_limit_overrides (user_id, scope, requests, period_seconds, updated_by) VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE requests = VALUES(requests), period_seconds = VALUES(period_seconds), updated_by = VALUES(updated_by)`,
+		override.UserID, override.Scope, override.Requests, override.PeriodSeconds, adminID,
+	)
+	return err
+}
+
+func DeleteOverride(db repository.Executor, userID int64, scope string) (bool, error) {
+	result, err := db.Exec("DELETE FROM rate_limit_overrides WHERE user_id = ? AND scope = ?", userID, scope)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
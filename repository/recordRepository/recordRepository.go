@@ -1,15 +1,15 @@
 package recordRepository
 
 import (
-	"database/sql"
 	"fmt"
 	"log"
 	"time"
 
 	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository"
 )
 
-func GetRecords(db *sql.DB, filter models.RecordFilter) ([]models.Record, int, error) {
+func GetRecords(db repository.Executor, filter models.RecordFilter) ([]models.Record, int, error) {
 	query := `
 		SELECT r.id, o.type AS operation_name, r.user_id, r.amount, r.user_balance, r.operation_response, r.date
 		FROM records r
@@ -81,16 +81,19 @@ func GetRecords(db *sql.DB, filter models.RecordFilter) ([]models.Record, int, e
 	return records, totalRecords, nil
 }
 
-func CreateRecord(db *sql.DB, operationID int64, userID int64, amount float64, userBalance float64, operationResponse string) error {
-	_, err := db.Exec(`
+func CreateRecord(db repository.Executor, operationID int64, userID int64, amount models.Money, userBalance models.Money, operationResponse string) (int64, error) {
+	result, err := db.Exec(`
 		INSERT INTO records (operation_id, user_id, amount, user_balance, operation_response, date) 
 		VALUES (?, ?, ?, ?, ?, ?)`,
 		operationID, userID, amount, userBalance, operationResponse, time.Now(),
 	)
-	return err
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
 }
 
-func SoftDeleteRecord(db *sql.DB, recordID int64, userID int64) error {
+func SoftDeleteRecord(db repository.Executor, recordID int64, userID int64) error {
 	query := "UPDATE records SET deleted_at = ? WHERE id = ? AND user_id = ? AND deleted_at IS NULL"
 	result, err := db.Exec(query, time.Now(), recordID, userID)
 	if err != nil {
@@ -0,0 +1,57 @@
+package refreshTokenRepository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository"
+)
+
+func CreateToken(db repository.Executor, userID int64, familyID, tokenHash string, expiresAt time.Time) error {
+	_, err := db.Exec(
+		"INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at) VALUES (?, ?, ?, ?)",
+		userID, familyID, tokenHash, expiresAt,
+	)
+	return err
+}
+
+func GetTokenByHashForUpdate(tx *sql.Tx, tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	var rotatedAt, revokedAt sql.NullTime
+	err := tx.QueryRow(`
+		SELECT id, user_id, family_id, expires_at, rotated_at, revoked_at
+		FROM refresh_tokens WHERE token_hash = ? FOR UPDATE`, tokenHash).
+		Scan(&token.ID, &token.UserID, &token.FamilyID, &token.ExpiresAt, &rotatedAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	if rotatedAt.Valid {
+		token.RotatedAt = &rotatedAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	return &token, nil
+}
+
+func GetFamilyByHash(db repository.Executor, tokenHash string) (string, error) {
+	var familyID string
+	err := db.QueryRow("SELECT family_id FROM refresh_tokens WHERE token_hash = ?", tokenHash).Scan(&familyID)
+	return familyID, err
+}
+
+func MarkRotated(db repository.Executor, tokenID int64, rotatedAt time.Time) error {
+	_, err := db.Exec("UPDATE refresh_tokens SET rotated_at = ? WHERE id = ?", rotatedAt, tokenID)
+	return err
+}
+
+func RevokeFamily(db repository.Executor, familyID string, revokedAt time.Time) error {
+	_, err := db.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL", revokedAt, familyID)
+	return err
+}
+
+func RevokeUserTokens(db repository.Executor, userID int64, revokedAt time.Time) error {
+	_, err := db.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", revokedAt, userID)
+	return err
+}
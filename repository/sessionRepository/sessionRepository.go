@@ -0,0 +1,58 @@
+package sessionRepository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository"
+)
+
+func CreateSession(db repository.Executor, session *models.Session) error {
+	_, err := db.Exec(`
+		INSERT INTO sessions (id, user_id, created_at, last_activity_at, idle_expires_at, absolute_expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		session.ID, session.UserID, session.CreatedAt, session.LastActivityAt, session.IdleExpiresAt, session.AbsoluteExpiresAt,
+	)
+	return err
+}
+
+func GetSession(db repository.Executor, sessionID string) (*models.Session, error) {
+	var session models.Session
+	var revokedAt sql.NullTime
+	err := db.QueryRow(`
+		SELECT id, user_id, created_at, last_activity_at, idle_expires_at, absolute_expires_at, revoked_at
+		FROM sessions WHERE id = ?`, sessionID).
+		Scan(&session.ID, &session.UserID, &session.CreatedAt, &session.LastActivityAt,
+			&session.IdleExpiresAt, &session.AbsoluteExpiresAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
+	}
+	return &session, nil
+}
+
+// Touch records activity and slides the idle expiry, never past the
+// absolute expiry. Rows touched after notBefore are left alone so busy
+// clients do not write on every request.
+func Touch(db repository.Executor, sessionID string, now, idleExpiresAt, notBefore time.Time) error {
+	_, err := db.Exec(`
+		UPDATE sessions
+		SET last_activity_at = ?, idle_expires_at = LEAST(?, absolute_expires_at)
+		WHERE id = ? AND revoked_at IS NULL AND last_activity_at < ?`,
+		now, idleExpiresAt, sessionID, notBefore,
+	)
+	return err
+}
+
+func RevokeSession(db repository.Executor, sessionID string, revokedAt time.Time) error {
+	_, err := db.Exec("UPDATE sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", revokedAt, sessionID)
+	return err
+}
+
+func RevokeUserSessions(db repository.Executor, userID int64, revokedAt time.Time) error {
+	_, err := db.Exec("UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", revokedAt, userID)
+	return err
+}
@@ -4,123 +4,187 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func GetUserByUsername(db *sql.DB, username string) (*models.User, error) {
+func GetUserByUsername(db repository.Executor, username string) (*models.User, error) {
 	var user models.User
-	query := "SELECT id, username, password, status FROM users WHERE username = ?"
-	err := db.QueryRow(query, username).Scan(&user.ID, &user.Username, &user.Password, &user.Status)
+	var deletedAt sql.NullTime
+	query := "SELECT id, username, password, status, deleted_at FROM users WHERE username = ?"
+	err := db.QueryRow(query, username).Scan(&user.ID, &user.Username, &user.Password, &user.Status, &deletedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, sql.ErrNoRows
 		}
 		return nil, err
 	}
+	if deletedAt.Valid {
+		user.DeletedAt = &deletedAt.Time
+	}
 	return &user, nil
 }
 
-func CreateUser(db *sql.DB, username, password string) error {
+func CreateUser(db *sql.DB, username, password string) (int64, error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		return fmt.Errorf("error al encriptar la contraseña: %v", err)
+		return 0, fmt.Errorf("error al encriptar la contraseña: %v", err)
 	}
 
 	tx, err := db.Begin()
 	if err != nil {
-		return fmt.Errorf("error al iniciar la transacción: %v", err)
+		return 0, fmt.Errorf("error al iniciar la transacción: %v", err)
 	}
 
 	var userID int64
-	result, err := tx.Exec("INSERT INTO users (username, password, status) VALUES (?, ?, ?)", username, string(hashedPassword), "active")
+	result, err := tx.Exec("INSERT INTO users (username, password, status) VALUES (?, ?, ?)", username, string(hashedPassword), models.StatusPendingVerification)
 	if err != nil {
 		tx.Rollback()
-		return fmt.Errorf("error al insertar el usuario: %v", err)
+		return 0, fmt.Errorf("error al insertar el usuario: %v", err)
 	}
 
 	userID, err = result.LastInsertId()
 	if err != nil {
 		tx.Rollback()
-		return fmt.Errorf("error al obtener el ID del usuario: %v", err)
+		return 0, fmt.Errorf("error al obtener el ID del usuario: %v", err)
 	}
 
 	_, err = tx.Exec("INSERT INTO balances (user_id, credits) VALUES (?, ?)", userID, 0)
 	if err != nil {
 		tx.Rollback()
-		return fmt.Errorf("error al insertar el balance: %v", err)
+		return 0, fmt.Errorf("error al insertar el balance: %v", err)
+	}
+
+	if err = AddUserRole(tx, userID, models.RoleUser); err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("error al asignar el rol: %v", err)
 	}
 
-	return tx.Commit()
+	return userID, tx.Commit()
 }
 
-func AddCredits(db *sql.DB, userID int64, creditsToAdd float64) error {
-	result, err := db.Exec("UPDATE balances SET credits = credits + ? WHERE user_id = ?", creditsToAdd, userID)
+// SetCredits overwrites the cached balance; callers must hold the row lock
+// and record the change in the ledger.
+func SetCredits(db repository.Executor, userID int64, credits models.Money) error {
+	_, err := db.Exec("UPDATE balances SET credits = ? WHERE user_id = ?", credits, userID)
+	return err
+}
+
+func GetCredits(db repository.Executor, userID int64) (models.Money, error) {
+	var credits models.Money
+	err := db.QueryRow("SELECT credits FROM balances WHERE user_id = ?", userID).Scan(&credits)
 	if err != nil {
-		return err
+		if err == sql.ErrNoRows {
+			return 0, errors.New("user not found")
+		}
+		return 0, err
 	}
+	return credits, nil
+}
 
-	affected, err := result.RowsAffected()
+func GetCreditsForUpdate(tx *sql.Tx, userID int64) (models.Money, error) {
+	var credits models.Money
+	err := tx.QueryRow("SELECT credits FROM balances WHERE user_id = ? FOR UPDATE", userID).Scan(&credits)
 	if err != nil {
-		return err
+		if err == sql.ErrNoRows {
+			return 0, errors.New("user not found")
+		}
+		return 0, err
 	}
+	return credits, nil
+}
 
-	if affected == 0 {
-		_, err = db.Exec("INSERT INTO balances (user_id, credits) VALUES (?, ?)", userID, creditsToAdd)
-		if err != nil {
-			return err
+func GetHeldCredits(db repository.Executor, userID int64) (models.Money, error) {
+	var held models.Money
+	err := db.QueryRow("SELECT held_credits FROM balances WHERE user_id = ?", userID).Scan(&held)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, errors.New("user not found")
 		}
+		return 0, err
 	}
+	return held, nil
+}
 
-	return nil
+// SetHeldCredits overwrites the credits reserved by pending jobs; callers
+// must hold the row lock.
+func SetHeldCredits(db repository.Executor, userID int64, held models.Money) error {
+	_, err := db.Exec("UPDATE balances SET held_credits = ? WHERE user_id = ?", held, userID)
+	return err
 }
-func RemoveCredits(db *sql.DB, userID int64, creditsToRemove float64) error {
-	result, err := db.Exec("UPDATE balances SET credits = credits - ? WHERE user_id = ? AND credits >= ?", creditsToRemove, userID, creditsToRemove)
+
+func GetUserByID(db repository.Executor, userID int64) (*models.User, error) {
+	var user models.User
+	var deletedAt sql.NullTime
+	query := "SELECT id, username, password, status, deleted_at FROM users WHERE id = ?"
+	err := db.QueryRow(query, userID).Scan(&user.ID, &user.Username, &user.Password, &user.Status, &deletedAt)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	if deletedAt.Valid {
+		user.DeletedAt = &deletedAt.Time
+	}
+	return &user, nil
+}
 
-	affected, err := result.RowsAffected()
+func GetUserRoles(db repository.Executor, userID int64) ([]string, error) {
+	rows, err := db.Query("SELECT role FROM user_roles WHERE user_id = ? ORDER BY role", userID)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	if affected == 0 {
-		return errors.New("insufficient credits")
+	roles := []string{}
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
 	}
+	return roles, rows.Err()
+}
 
-	return nil
+func AddUserRole(db repository.Executor, userID int64, role string) error {
+	_, err := db.Exec("INSERT IGNORE INTO user_roles (user_id, role) VALUES (?, ?)", userID, role)
+	return err
 }
 
-func GetCredits(db *sql.DB, userID int64) (float64, error) {
-	var credits float64
-	err := db.QueryRow("SELECT credits FROM balances WHERE user_id = ?", userID).Scan(&credits)
+func DeleteUserRoles(db repository.Executor, userID int64) error {
+	_, err := db.Exec("DELETE FROM user_roles WHERE user_id = ?", userID)
+	return err
+}
+
+func UpdatePassword(db repository.Executor, userID int64, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return 0, errors.New("user not found")
-		}
-		return 0, err
+		return fmt.Errorf("error hashing password: %v", err)
 	}
-	return credits, nil
+	_, err = db.Exec("UPDATE users SET password = ? WHERE id = ?", string(hashedPassword), userID)
+	return err
+}
+
+func SetStatus(db repository.Executor, userID int64, status string) error {
+	_, err := db.Exec("UPDATE users SET status = ? WHERE id = ?", status, userID)
+	return err
 }
 
-func GetAllOperations(db *sql.DB) ([]models.Operation, error) {
-	query := "SELECT id, type FROM operations"
-	rows, err := db.Query(query)
+func GetVerificationSentAtForUpdate(tx *sql.Tx, userID int64) (*time.Time, error) {
+	var sentAt sql.NullTime
+	err := tx.QueryRow("SELECT verification_sent_at FROM users WHERE id = ? FOR UPDATE", userID).Scan(&sentAt)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var operations []models.Operation
-	for rows.Next() {
-		var operation models.Operation
-		if err := rows.Scan(&operation.ID, &operation.Type); err != nil {
-			return nil, err
-		}
-		operations = append(operations, operation)
+	if !sentAt.Valid {
+		return nil, nil
 	}
+	return &sentAt.Time, nil
+}
 
-	return operations, nil
+func SetVerificationSentAt(db repository.Executor, userID int64, sentAt time.Time) error {
+	_, err := db.Exec("UPDATE users SET verification_sent_at = ? WHERE id = ?", sentAt, userID)
+	return err
 }
@@ -0,0 +1,132 @@
+package apiKeyService
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository/apiKeyRepository"
+)
+
+// keyPrefix starts every key so leaked keys are easy to grep for.
+const keyPrefix = "ak_"
+
+const maxNameLength = 100
+
+type ErrInvalidAPIKeyRequest string
+
+func (e ErrInvalidAPIKeyRequest) Error() string {
+	return string(e)
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// newKey returns the full secret and its public prefix, e.g.
+// "ak_1a2b3c4d_<secret>" and "ak_1a2b3c4d".
+func newKey() (string, string, error) {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	prefix := keyPrefix + hex.EncodeToString(id)
+	return prefix + "_" + base64.RawURLEncoding.EncodeToString(secret), prefix, nil
+}
+
+// Create issues a key for userID. The returned secret is shown to the user
+// once; only its hash is stored.
+func Create(db *sql.DB, userID int64, name string, scopes []string, expiresAt *time.Time) (*models.APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxNameLength {
+		return nil, "", ErrInvalidAPIKeyRequest(fmt.Sprintf("name is required and must be at most %d characters", maxNameLength))
+	}
+	if len(scopes) == 0 {
+		return nil, "", ErrInvalidAPIKeyRequest("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !models.IsValidScope(scope) || strings.Contains(scope, ",") {
+			return nil, "", ErrInvalidAPIKeyRequest(fmt.Sprintf("unknown scope %q", scope))
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, "", ErrInvalidAPIKeyRequest("expires_at must be in the future")
+	}
+
+	secret, prefix, err := newKey()
+	if err != nil {
+		return nil, "", err
+	}
+	key := &models.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    prefix,
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+	key.ID, err = apiKeyRepository.CreateAPIKey(db, key, hashKey(secret))
+	if err != nil {
+		return nil, "", err
+	}
+	return key, secret, nil
+}
+
+func List(db *sql.DB, userID int64) ([]models.APIKey, error) {
+	return apiKeyRepository.GetUserAPIKeys(db, userID)
+}
+
+func Revoke(db *sql.DB, userID, keyID int64) error {
+	revoked, err := apiKeyRepository.RevokeAPIKey(db, userID, keyID, time.Now())
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return models.ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// RevokeAllForUser revokes every key of the user, so a leaked key does not
+// outlive a password reset.
+func RevokeAllForUser(db repository.Executor, userID int64) error {
+	return apiKeyRepository.RevokeUserAPIKeys(db, userID, time.Now())
+}
+
+// Authenticate resolves a presented key, recording when and from where it
+// was used. The owner's account is checked by AuthMiddleware.
+func Authenticate(db *sql.DB, secret, ip string) (*models.APIKey, error) {
+	if !strings.HasPrefix(secret, keyPrefix) {
+		return nil, models.ErrInvalidAPIKey
+	}
+	key, err := apiKeyRepository.GetAPIKeyByHash(db, hashKey(secret))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && !now.Before(*key.ExpiresAt)) {
+		return nil, models.ErrInvalidAPIKey
+	}
+
+	if err := apiKeyRepository.TouchAPIKey(db, key.ID, now, ip); err != nil {
+		log.Printf("Error recording API key use: %v", err)
+	}
+	return key, nil
+}
@@ -1,24 +1,32 @@
 package authHelpers
 
 import (
-	"errors"
-	"net/http"
-	"strings"
+	"database/sql"
 
 	"github.com/Ignacio-J-Maylin/arithmetic-calculator/middlewares"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/apiKeyService"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/userService"
 )
 
-func GetUserIDFromToken(r *http.Request) (int64, error) {
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" || len(authHeader) < 8 || authHeader[:7] != "Bearer " {
-		return 0, errors.New("missing or invalid token")
+// UserLoader lets AuthMiddleware read the caller's account and roles.
+func UserLoader(db *sql.DB) middlewares.UserLoader {
+	return func(userID int64) (*models.User, []string, error) {
+		user, err := userService.GetUserByID(db, userID)
+		if err != nil {
+			return nil, nil, err
+		}
+		roles, err := userService.GetUserRoles(db, userID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return user, roles, nil
 	}
+}
 
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	claims, err := middlewares.ValidateJWT(tokenString)
-	if err != nil || claims.UserID == 0 {
-		return 0, errors.New("unauthorized")
+// APIKeyAuthenticator resolves "Authorization: ApiKey" credentials.
+func APIKeyAuthenticator(db *sql.DB) func(key, ip string) (*models.APIKey, error) {
+	return func(key, ip string) (*models.APIKey, error) {
+		return apiKeyService.Authenticate(db, key, ip)
 	}
-
-	return claims.UserID, nil
 }
@@ -0,0 +1,312 @@
+package batchService
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository/recordRepository"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository/userRepository"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/ledgerService"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/operationService"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/userService"
+)
+
+const MaxItems = 100
+
+const (
+	ModeAllOrNothing = "all_or_nothing"
+	ModeBestEffort   = "best_effort"
+)
+
+const (
+	ItemSucceeded  = "succeeded"
+	ItemFailed     = "failed"
+	ItemSkipped    = "skipped"
+	ItemRolledBack = "rolled_back"
+)
+
+type ErrInvalidBatch string
+
+func (e ErrInvalidBatch) Error() string {
+	return string(e)
+}
+
+var (
+	ErrInvalidItems = errors.New("one or more operations are invalid")
+	ErrBatchFailed  = errors.New("an operation failed; the batch was not charged")
+)
+
+// Item is one operation request of a batch.
+type Item struct {
+	OperationType string
+	Operands      operationService.Operands
+}
+
+type ItemResult struct {
+	Index         int          `json:"index"`
+	OperationType string       `json:"operation_type"`
+	Status        string       `json:"status,omitempty"`
+	Result        interface{}  `json:"result,omitempty"`
+	Cost          models.Money `json:"cost"`
+	RecordID      *int64       `json:"record_id,omitempty"`
+	Error         string       `json:"error,omitempty"`
+	Column        int          `json:"column,omitempty"`
+}
+
+func (r *ItemResult) fail(err error) {
+	r.Status = ItemFailed
+	r.Result = nil
+	r.Error = err.Error()
+	var exprErr *operationService.ExpressionError
+	if errors.As(err, &exprErr) {
+		r.Error = exprErr.Message
+		r.Column = exprErr.Column
+	}
+}
+
+type Result struct {
+	Mode      string       `json:"mode"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Charged   models.Money `json:"charged"`
+	Refunded  models.Money `json:"refunded"`
+	Balance   models.Money `json:"balance"`
+	Items     []ItemResult `json:"items"`
+}
+
+type preparedItem struct {
+	op        operationService.Operation
+	operation *models.Operation
+	operands  operationService.Operands
+	response  string
+	result    ItemResult
+}
+
+// Batch is a validated and priced set of operations ready to be run.
+type Batch struct {
+	Mode  string
+	Total models.Money
+	items []preparedItem
+}
+
+// Prepare validates and prices every item before anything is charged. In
+// all-or-nothing mode a single invalid item rejects the batch with
+// ErrInvalidItems; in best-effort mode invalid items are reported as failed
+// and left out of the charge.
+func Prepare(db *sql.DB, items []Item, mode string) (*Batch, error) {
+	if mode == "" {
+		mode = ModeAllOrNothing
+	}
+	if mode != ModeAllOrNothing && mode != ModeBestEffort {
+		return nil, ErrInvalidBatch("mode must be 'all_or_nothing' or 'best_effort'")
+	}
+	if len(items) == 0 {
+		return nil, ErrInvalidBatch("operations must not be empty")
+	}
+	if len(items) > MaxItems {
+		return nil, ErrInvalidBatch(fmt.Sprintf("a batch holds at most %d operations", MaxItems))
+	}
+
+	batch := &Batch{Mode: mode, items: make([]preparedItem, len(items))}
+	invalid := false
+	for i, item := range items {
+		prepared := &batch.items[i]
+		prepared.operands = item.Operands
+		prepared.result = ItemResult{Index: i, OperationType: item.OperationType}
+
+		op, ok := operationService.Lookup(item.OperationType)
+		if !ok {
+			prepared.result.fail(errors.New("invalid operation type"))
+			invalid = true
+			continue
+		}
+		if err := operationService.Validate(op, item.Operands); err != nil {
+			prepared.result.fail(err)
+			invalid = true
+			continue
+		}
+
+		operation, err := operationService.GetOperation(db, op.Name())
+		var cost models.Money
+		if err == nil {
+			cost, err = operationService.OperationCost(db, operation, op, item.Operands)
+		}
+		if errors.Is(err, models.ErrOperationNotFound) || errors.Is(err, models.ErrOperationInactive) {
+			prepared.result.fail(err)
+			invalid = true
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		prepared.op = op
+		prepared.operation = operation
+		prepared.result.Cost = cost
+		if batch.Total, err = batch.Total.Add(cost); err != nil {
+			return nil, err
+		}
+	}
+
+	if invalid && mode == ModeAllOrNothing {
+		return batch, ErrInvalidItems
+	}
+	return batch, nil
+}
+
+// Operations lists the type of every valid item, once per item.
+func (b *Batch) Operations() []string {
+	names := make([]string, 0, len(b.items))
+	for _, item := range b.items {
+		if item.op != nil {
+			names = append(names, item.op.Name())
+		}
+	}
+	return names
+}
+
+func (b *Batch) Results() []ItemResult {
+	results := make([]ItemResult, len(b.items))
+	for i, item := range b.items {
+		results[i] = item.result
+	}
+	return results
+}
+
+// Run evaluates every item and then, in one transaction, locks the balance,
+// debits the whole batch once, writes a record per evaluated item and
+// refunds the items that failed, so the user is never charged without
+// records. In all-or-nothing mode the first failure stops evaluation and
+// nothing is charged or recorded; ErrBatchFailed is returned alongside the
+// per-item results.
+func Run(db *sql.DB, userID int64, batch *Batch) (*Result, error) {
+	credits, err := userService.GetUserCredits(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if credits < batch.Total {
+		return nil, models.ErrInsufficientCredits
+	}
+
+	failed := false
+	for i := range batch.items {
+		item := &batch.items[i]
+		if item.op == nil {
+			continue
+		}
+		if failed && batch.Mode == ModeAllOrNothing {
+			item.result.Status = ItemSkipped
+			continue
+		}
+
+		value, err := operationService.Evaluate(item.op, item.operands)
+		if err == nil {
+			item.response, err = operationService.RecordResponse(item.op, item.operands, value)
+		}
+		if err != nil {
+			item.result.fail(err)
+			failed = true
+			continue
+		}
+		item.result.Status = ItemSucceeded
+		item.result.Result = value
+	}
+
+	result := &Result{Mode: batch.Mode}
+	if failed && batch.Mode == ModeAllOrNothing {
+		for i := range batch.items {
+			if batch.items[i].result.Status == ItemSucceeded {
+				batch.items[i].result.Status = ItemRolledBack
+				batch.items[i].result.Result = nil
+			}
+		}
+		result.Balance = credits
+	} else if err := settle(db, userID, batch, result); err != nil {
+		return nil, err
+	}
+
+	result.Items = batch.Results()
+	for _, item := range result.Items {
+		switch item.Status {
+		case ItemSucceeded:
+			result.Succeeded++
+		case ItemFailed:
+			result.Failed++
+		}
+	}
+	if failed && batch.Mode == ModeAllOrNothing {
+		return result, ErrBatchFailed
+	}
+	return result, nil
+}
+
+// settle debits the batch total, records every evaluated item and refunds
+// the cost of the ones that failed, each refund pointing at the failed
+// item's record, all in a single transaction.
+func settle(db *sql.DB, userID int64, batch *Batch, result *Result) error {
+	return repository.WithTx(db, func(tx *sql.Tx) error {
+		balance, err := userRepository.GetCreditsForUpdate(tx, userID)
+		if err != nil {
+			return err
+		}
+		if batch.Total > 0 {
+			entry, err := ledgerService.PostTx(tx, ledgerService.Posting{
+				UserID: userID,
+				Type:   models.LedgerDebit,
+				Amount: -batch.Total,
+				Reason: "Batch operation charge",
+			})
+			if err != nil {
+				return err
+			}
+			balance = *entry.BalanceAfter
+		}
+
+		var refunded models.Money
+		for i := range batch.items {
+			item := &batch.items[i]
+			if item.op == nil {
+				continue
+			}
+
+			response := item.response
+			if item.result.Status == ItemFailed {
+				encoded, err := json.Marshal(map[string]string{"error": item.result.Error})
+				if err != nil {
+					return err
+				}
+				response = string(encoded)
+			}
+
+			recordID, err := recordRepository.CreateRecord(tx, item.operation.ID, userID, item.result.Cost, balance, response)
+			if err != nil {
+				return err
+			}
+			item.result.RecordID = &recordID
+
+			if item.result.Status == ItemFailed && item.result.Cost > 0 {
+				entry, err := ledgerService.PostTx(tx, ledgerService.Posting{
+					UserID:   userID,
+					Type:     models.LedgerRefund,
+					Amount:   item.result.Cost,
+					Reason:   "Batch item refund",
+					RecordID: &recordID,
+				})
+				if err != nil {
+					return err
+				}
+				balance = *entry.BalanceAfter
+				refunded += item.result.Cost
+			}
+		}
+
+		result.Charged = batch.Total - refunded
+		result.Refunded = refunded
+		result.Balance = balance
+		return nil
+	})
+}
@@ -0,0 +1,198 @@
+package batchService
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/operationService"
+)
+
+func newMock(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+	return db, mock
+}
+
+func items(t *testing.T, operations ...string) []Item {
+	t.Helper()
+	var batch []Item
+	for i := 0; i < len(operations); i += 2 {
+		var operands operationService.Operands
+		if err := json.Unmarshal([]byte(operations[i+1]), &operands); err != nil {
+			t.Fatal(err)
+		}
+		batch = append(batch, Item{OperationType: operations[i], Operands: operands})
+	}
+	return batch
+}
+
+func expectCatalog(mock sqlmock.Sqlmock, id int, operationType, cost string) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, type, cost, status FROM operations WHERE type = ?")).
+		WithArgs(operationType).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "cost", "status"}).
+			AddRow(id, operationType, cost, models.StatusActive))
+}
+
+func expectBalance(mock sqlmock.Sqlmock, credits string) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT credits FROM balances WHERE user_id = ?")).
+		WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"credits"}).AddRow(credits))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(SUM(amount), 0) FROM ledger_entries")).
+		WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(credits))
+}
+
+// expectPosting expects ledgerService.PostTx moving a balance of from by
+// amount to to.
+func expectPosting(mock sqlmock.Sqlmock, entryType, from, amount, to string, debit bool) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT credits FROM balances WHERE user_id = ? FOR UPDATE")).
+		WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"credits"}).AddRow(from))
+	if debit {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT held_credits FROM balances WHERE user_id = ?")).
+			WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"held_credits"}).AddRow("0"))
+	}
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO ledger_entries")).
+		WithArgs(sqlmock.AnyArg(), models.LedgerAccountUserCredits, 7, entryType, amount, to, sqlmock.AnyArg(), sqlmock.AnyArg(), nil, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO ledger_entries")).WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE balances SET credits = ? WHERE user_id = ?")).
+		WithArgs(to, 7).WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func expectRecord(mock sqlmock.Sqlmock, operationID int, cost, balance string, recordID int64) {
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO records")).
+		WithArgs(operationID, 7, cost, balance, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(recordID, 1))
+}
+
+// Best effort debits the whole batch once, writes a record per item and
+// refunds the failed item against its own record.
+func TestRunBestEffortRefundsFailedItems(t *testing.T) {
+	db, mock := newMock(t)
+	expectCatalog(mock, 1, models.OperationAddition, "1")
+	expectCatalog(mock, 4, models.OperationDivision, "2")
+
+	batch, err := Prepare(db, items(t,
+		models.OperationAddition, `{"a":1,"b":2}`,
+		models.OperationDivision, `{"a":1,"b":0}`,
+	), ModeBestEffort)
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	if batch.Total.String() != "3" {
+		t.Fatalf("batch total = %s, want 3", batch.Total)
+	}
+
+	expectBalance(mock, "10")
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT credits FROM balances WHERE user_id = ? FOR UPDATE")).
+		WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"credits"}).AddRow("10"))
+	expectPosting(mock, models.LedgerDebit, "10", "-3", "7", true)
+	expectRecord(mock, 1, "1", "7", 100)
+	expectRecord(mock, 4, "2", "7", 101)
+	expectPosting(mock, models.LedgerRefund, "7", "2", "9", false)
+	mock.ExpectCommit()
+
+	result, err := Run(db, 7, batch)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Succeeded != 1 || result.Failed != 1 ||
+		result.Charged.String() != "1" || result.Refunded.String() != "2" || result.Balance.String() != "9" {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if result.Items[0].Status != ItemSucceeded || *result.Items[0].RecordID != 100 ||
+		result.Items[1].Status != ItemFailed || *result.Items[1].RecordID != 101 {
+		t.Fatalf("unexpected items %+v", result.Items)
+	}
+}
+
+// All-or-nothing charges and records nothing when any item fails, and skips
+// the items after the failure.
+func TestRunAllOrNothingChargesNothingOnFailure(t *testing.T) {
+	db, mock := newMock(t)
+	expectCatalog(mock, 1, models.OperationAddition, "1")
+	expectCatalog(mock, 4, models.OperationDivision, "2")
+	expectCatalog(mock, 1, models.OperationAddition, "1")
+
+	batch, err := Prepare(db, items(t,
+		models.OperationAddition, `{"a":1,"b":2}`,
+		models.OperationDivision, `{"a":1,"b":0}`,
+		models.OperationAddition, `{"a":3,"b":4}`,
+	), ModeAllOrNothing)
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+
+	expectBalance(mock, "10")
+
+	result, err := Run(db, 7, batch)
+	if !errors.Is(err, ErrBatchFailed) {
+		t.Fatalf("Run = %v, want ErrBatchFailed", err)
+	}
+	want := []string{ItemRolledBack, ItemFailed, ItemSkipped}
+	for i, item := range result.Items {
+		if item.Status != want[i] || item.RecordID != nil {
+			t.Fatalf("item %d = %+v, want %s without a record", i, item, want[i])
+		}
+	}
+	if result.Charged != 0 || result.Balance.String() != "10" {
+		t.Fatalf("unexpected result %+v", result)
+	}
+}
+
+func TestRunRefusesBatchBeyondBalance(t *testing.T) {
+	db, mock := newMock(t)
+	expectCatalog(mock, 1, models.OperationAddition, "5")
+	expectCatalog(mock, 1, models.OperationAddition, "5")
+
+	batch, err := Prepare(db, items(t,
+		models.OperationAddition, `{"a":1,"b":2}`,
+		models.OperationAddition, `{"a":3,"b":4}`,
+	), ModeBestEffort)
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+
+	expectBalance(mock, "9")
+	if _, err := Run(db, 7, batch); !errors.Is(err, models.ErrInsufficientCredits) {
+		t.Fatalf("Run = %v, want ErrInsufficientCredits", err)
+	}
+}
+
+func TestPrepareRejectsInvalidItems(t *testing.T) {
+	db, mock := newMock(t)
+	expectCatalog(mock, 1, models.OperationAddition, "1")
+
+	batch, err := Prepare(db, items(t,
+		models.OperationAddition, `{"a":1,"b":2}`,
+		"teleport", `{}`,
+	), ModeAllOrNothing)
+	if !errors.Is(err, ErrInvalidItems) {
+		t.Fatalf("Prepare = %v, want ErrInvalidItems", err)
+	}
+	if results := batch.Results(); results[1].Status != ItemFailed {
+		t.Fatalf("invalid item = %+v, want failed", results[1])
+	}
+
+	var invalid ErrInvalidBatch
+	if _, err := Prepare(db, items(t, models.OperationAddition, `{"a":1,"b":2}`), "sometimes"); !errors.As(err, &invalid) {
+		t.Errorf("Prepare with an unknown mode = %v, want ErrInvalidBatch", err)
+	}
+	if _, err := Prepare(db, nil, ModeBestEffort); !errors.As(err, &invalid) {
+		t.Errorf("Prepare of an empty batch = %v, want ErrInvalidBatch", err)
+	}
+}
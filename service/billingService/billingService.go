@@ -0,0 +1,105 @@
+package billingService
+
+import (
+	"database/sql"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository/recordRepository"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository/userRepository"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/ledgerService"
+)
+
+type Charge struct {
+	RecordID int64
+	Balance  models.Money
+}
+
+// ChargeOperation locks the user's balance row, inserts the operation record
+// and posts its debit to the ledger in a single transaction, so a user is
+// never charged without history and user_balance reflects the real
+// post-debit balance.
+func ChargeOperation(db *sql.DB, userID, operationID int64, cost models.Money, operationResponse string) (*Charge, error) {
+	var charge *Charge
+	err := repository.WithTx(db, func(tx *sql.Tx) error {
+		var err error
+		charge, err = chargeTx(tx, userID, operationID, cost, operationResponse)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return charge, nil
+}
+
+func chargeTx(tx *sql.Tx, userID, operationID int64, cost models.Money, operationResponse string) (*Charge, error) {
+	credits, err := userRepository.GetCreditsForUpdate(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if credits < cost {
+		return nil, models.ErrInsufficientCredits
+	}
+
+	charge := &Charge{Balance: credits - cost}
+	charge.RecordID, err = recordRepository.CreateRecord(tx, operationID, userID, cost, charge.Balance, operationResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	if cost > 0 {
+		_, err = ledgerService.PostTx(tx, ledgerService.Posting{
+			UserID:   userID,
+			Type:     models.LedgerDebit,
+			Amount:   -cost,
+			Reason:   "Operation charge",
+			RecordID: &charge.RecordID,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return charge, nil
+}
+
+// PlaceHoldTx reserves amount of the user's available credits (balance minus
+// what is already held) so a queued job can be charged later.
+func PlaceHoldTx(tx *sql.Tx, userID int64, amount models.Money) error {
+	credits, err := userRepository.GetCreditsForUpdate(tx, userID)
+	if err != nil {
+		return err
+	}
+	held, err := userRepository.GetHeldCredits(tx, userID)
+	if err != nil {
+		return err
+	}
+	if credits-held < amount {
+		return models.ErrInsufficientCredits
+	}
+	return userRepository.SetHeldCredits(tx, userID, held+amount)
+}
+
+// ReleaseHoldTx returns held credits to the user's available balance.
+func ReleaseHoldTx(tx *sql.Tx, userID int64, amount models.Money) error {
+	if _, err := userRepository.GetCreditsForUpdate(tx, userID); err != nil {
+		return err
+	}
+	held, err := userRepository.GetHeldCredits(tx, userID)
+	if err != nil {
+		return err
+	}
+	held -= amount
+	if held < 0 {
+		held = 0
+	}
+	return userRepository.SetHeldCredits(tx, userID, held)
+}
+
+// CaptureHoldTx releases a hold and charges the same amount for the
+// operation, writing its record and ledger debit.
+func CaptureHoldTx(tx *sql.Tx, userID, operationID int64, amount models.Money, operationResponse string) (*Charge, error) {
+	if err := ReleaseHoldTx(tx, userID, amount); err != nil {
+		return nil, err
+	}
+	return chargeTx(tx, userID, operationID, amount, operationResponse)
+}
@@ -0,0 +1,110 @@
+package billingService
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+)
+
+func newMock(t *testing.T) (sqlmock.Sqlmock, func(cost models.Money) (*Charge, error)) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+	return mock, func(cost models.Money) (*Charge, error) {
+		return ChargeOperation(db, 7, 3, cost, `{"result":"3"}`)
+	}
+}
+
+func expectLockedCredits(mock sqlmock.Sqlmock, credits string) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT credits FROM balances WHERE user_id = ? FOR UPDATE")).
+		WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"credits"}).AddRow(credits))
+}
+
+func expectRecord(mock sqlmock.Sqlmock, cost, balance string) {
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO records")).
+		WithArgs(3, 7, cost, balance, `{"result":"3"}`, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(99, 1))
+}
+
+// The balance is locked, the record written with the post-debit balance and
+// the debit posted in one transaction.
+func TestChargeOperationDebitsAndRecordsTogether(t *testing.T) {
+	mock, charge := newMock(t)
+	mock.ExpectBegin()
+	expectLockedCredits(mock, "10")
+	expectRecord(mock, "2", "8")
+	expectLockedCredits(mock, "10")
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT held_credits FROM balances WHERE user_id = ?")).
+		WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"held_credits"}).AddRow("0"))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO ledger_entries")).
+		WithArgs(sqlmock.AnyArg(), models.LedgerAccountUserCredits, 7, models.LedgerDebit, "-2", "8", sqlmock.AnyArg(), 99, nil, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO ledger_entries")).WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE balances SET credits = ? WHERE user_id = ?")).
+		WithArgs("8", 7).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	result, err := charge(2 * models.MoneyScale)
+	if err != nil {
+		t.Fatalf("ChargeOperation: %v", err)
+	}
+	if result.RecordID != 99 || result.Balance.String() != "8" {
+		t.Fatalf("ChargeOperation = %+v, want record 99 and balance 8", result)
+	}
+}
+
+func TestChargeOperationInsufficientCreditsWritesNothing(t *testing.T) {
+	mock, charge := newMock(t)
+	mock.ExpectBegin()
+	expectLockedCredits(mock, "1")
+	mock.ExpectRollback()
+
+	if _, err := charge(2 * models.MoneyScale); !errors.Is(err, models.ErrInsufficientCredits) {
+		t.Fatalf("ChargeOperation = %v, want ErrInsufficientCredits", err)
+	}
+}
+
+// When the debit cannot be posted the record insert is rolled back with it,
+// so there is never history without a charge or a charge without history.
+func TestChargeOperationRollsBackRecordWhenDebitFails(t *testing.T) {
+	mock, charge := newMock(t)
+	mock.ExpectBegin()
+	expectLockedCredits(mock, "10")
+	expectRecord(mock, "2", "8")
+	expectLockedCredits(mock, "10")
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT held_credits FROM balances WHERE user_id = ?")).
+		WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"held_credits"}).AddRow("9"))
+	mock.ExpectRollback()
+
+	if _, err := charge(2 * models.MoneyScale); !errors.Is(err, models.ErrInsufficientCredits) {
+		t.Fatalf("ChargeOperation = %v, want ErrInsufficientCredits", err)
+	}
+}
+
+func TestChargeOperationFreeOperationPostsNoLedgerEntry(t *testing.T) {
+	mock, charge := newMock(t)
+	mock.ExpectBegin()
+	expectLockedCredits(mock, "10")
+	expectRecord(mock, "0", "10")
+	mock.ExpectCommit()
+
+	result, err := charge(0)
+	if err != nil {
+		t.Fatalf("ChargeOperation: %v", err)
+	}
+	if result.Balance.String() != "10" {
+		t.Fatalf("balance = %s, want 10", result.Balance)
+	}
+}
@@ -0,0 +1,198 @@
+package emailVerificationService
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository/userRepository"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/keyManager"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/mailService"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// TokenType marks verification links so they can never be used as access
+// tokens, and access tokens can never verify an address.
+const TokenType = "email_verification"
+
+var (
+	keys           *keyManager.KeyManager
+	linkLifetime   = 24 * time.Hour
+	resendInterval = time.Minute
+	verifyURL      = "http://localhost:3000/verify-email"
+	queue          *mailService.Queue
+)
+
+// Configure sets the keys verification links are signed with, how long a
+// link stays valid, the minimum time between two emails to one user and the
+// frontend page links point to.
+func Configure(km *keyManager.KeyManager, lifetime, resend time.Duration, pageURL string) {
+	keys = km
+	linkLifetime = lifetime
+	resendInterval = resend
+	if pageURL != "" {
+		verifyURL = pageURL
+	}
+}
+
+// StartWorkers starts the workers that send queued verification emails,
+// holding at most queueSize of them. They stop once ctx is cancelled and the
+// queue is drained; the returned function waits for that.
+func StartWorkers(ctx context.Context, workers, queueSize int) (wait func()) {
+	queue = mailService.NewQueue("verification", queueSize)
+	return queue.Start(ctx, workers)
+}
+
+// ResendTooSoonError is returned when a verification email was sent less
+// than the resend interval ago.
+type ResendTooSoonError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ResendTooSoonError) Error() string {
+	return fmt.Sprintf("verification email already sent, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+type claims struct {
+	Email     string `json:"email"`
+	TokenType string `json:"typ"`
+	jwt.StandardClaims
+}
+
+func signLink(user *models.User) (string, error) {
+	if keys == nil {
+		return "", errors.New("signing keys not configured")
+	}
+	now := time.Now()
+	token, err := keys.Sign(&claims{
+		Email:     user.Username,
+		TokenType: TokenType,
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    keys.Issuer,
+			Audience:  keys.Audience,
+			Subject:   strconv.FormatInt(user.ID, 10),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(linkLifetime).Unix(),
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	link, err := url.Parse(verifyURL)
+	if err != nil {
+		return "", err
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String(), nil
+}
+
+func send(user *models.User) error {
+	link, err := signLink(user)
+	if err != nil {
+		return err
+	}
+	return mailService.SendTemplate(user.Username, "email_verification", map[string]string{
+		"Email":     user.Username,
+		"Link":      link,
+		"ExpiresIn": linkLifetime.String(),
+	})
+}
+
+// SendVerification queues a verification link for a pending user, refusing
+// with *ResendTooSoonError while the previous email is too recent. The send
+// time is committed first so the row lock is not held while mail is
+// delivered; mailService.ErrQueueFull means the email was dropped.
+func SendVerification(db *sql.DB, userID int64) error {
+	var user *models.User
+	err := repository.WithTx(db, func(tx *sql.Tx) error {
+		var err error
+		user, err = userRepository.GetUserByID(tx, userID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return models.ErrUserNotFound
+			}
+			return err
+		}
+		if user.Status != models.StatusPendingVerification {
+			return models.ErrAlreadyVerified
+		}
+
+		sentAt, err := userRepository.GetVerificationSentAtForUpdate(tx, userID)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if sentAt != nil {
+			if wait := sentAt.Add(resendInterval).Sub(now); wait > 0 {
+				return &ResendTooSoonError{RetryAfter: wait}
+			}
+		}
+		return userRepository.SetVerificationSentAt(tx, userID, now)
+	})
+	if err != nil {
+		return err
+	}
+
+	if queue == nil {
+		return errors.New("verification workers not started")
+	}
+	return queue.Enqueue(func() error {
+		return send(user)
+	})
+}
+
+// Verify checks a signed verification token and activates its user.
+// Verifying an already active account is not an error.
+func Verify(db *sql.DB, token string) error {
+	if keys == nil {
+		return errors.New("signing keys not configured")
+	}
+
+	parsed := &claims{}
+	parser := jwt.NewParser(jwt.WithValidMethods(keys.ValidMethods()), jwt.WithoutClaimsValidation())
+	if _, err := parser.ParseWithClaims(token, parsed, keys.Keyfunc); err != nil {
+		return models.ErrInvalidVerification
+	}
+	now := time.Now().Unix()
+	if parsed.TokenType != TokenType ||
+		!parsed.VerifyExpiresAt(now, true) ||
+		!parsed.VerifyIssuer(keys.Issuer, true) ||
+		!parsed.VerifyAudience(keys.Audience, true) {
+		return models.ErrInvalidVerification
+	}
+
+	userID, err := strconv.ParseInt(parsed.Subject, 10, 64)
+	if err != nil {
+		return models.ErrInvalidVerification
+	}
+	user, err := userRepository.GetUserByID(db, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrInvalidVerification
+		}
+		return err
+	}
+	// A link issued for a previous address of the account must not verify
+	// the current one.
+	if user.Username != parsed.Email {
+		return models.ErrInvalidVerification
+	}
+
+	switch user.Status {
+	case models.StatusActive:
+		return nil
+	case models.StatusPendingVerification:
+		return userRepository.SetStatus(db, userID, models.StatusActive)
+	default:
+		return models.ErrInvalidVerification
+	}
+}
@@ -0,0 +1,115 @@
+package emailVerificationService
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/keyManager"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/mailService"
+)
+
+func setup(t *testing.T) *mailService.MemoryMailer {
+	t.Helper()
+	key, err := keyManager.NewHMACKey("test", []byte(strings.Repeat("k", 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	Configure(keyManager.New(key, "issuer", "audience", 0), time.Hour, time.Minute, "")
+	mailer := mailService.NewMemoryMailer()
+	mailService.SetMailer(mailer, "")
+	queue = mailService.NewQueue("verification", 1)
+	return mailer
+}
+
+func expectPendingUser(mock sqlmock.Sqlmock, sentAt interface{}) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, password, status, deleted_at FROM users WHERE id = ?")).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "status", "deleted_at"}).
+			AddRow(7, "user@example.com", "hash", models.StatusPendingVerification, nil))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT verification_sent_at FROM users WHERE id = ? FOR UPDATE")).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"verification_sent_at"}).AddRow(sentAt))
+}
+
+// The send time is committed before the email goes out, so a slow mailer
+// never holds the transaction or its row lock.
+func TestSendVerificationCommitsBeforeSending(t *testing.T) {
+	mailer := setup(t)
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	expectPendingUser(mock, nil)
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET verification_sent_at = ? WHERE id = ?")).
+		WithArgs(sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := SendVerification(db, 7); err != nil {
+		t.Fatalf("SendVerification: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if sent := len(mailer.Messages()); sent != 0 {
+		t.Fatalf("%d emails sent inside the request, want them queued", sent)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	queue.Start(ctx, 1)()
+
+	messages := mailer.Messages()
+	if len(messages) != 1 || messages[0].To != "user@example.com" || !strings.Contains(messages[0].Body, "token=") {
+		t.Fatalf("queued verification email not delivered: %+v", messages)
+	}
+}
+
+func TestSendVerificationTooSoon(t *testing.T) {
+	setup(t)
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	expectPendingUser(mock, time.Now().Add(-10*time.Second))
+	mock.ExpectRollback()
+
+	var tooSoon *ResendTooSoonError
+	if err := SendVerification(db, 7); !errors.As(err, &tooSoon) || tooSoon.RetryAfter <= 0 {
+		t.Fatalf("SendVerification = %v, want ResendTooSoonError", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSendVerificationQueueFull(t *testing.T) {
+	setup(t)
+	queue.Enqueue(func() error { return nil })
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	expectPendingUser(mock, nil)
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET verification_sent_at = ? WHERE id = ?")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := SendVerification(db, 7); !errors.Is(err, mailService.ErrQueueFull) {
+		t.Fatalf("SendVerification = %v, want ErrQueueFull", err)
+	}
+}
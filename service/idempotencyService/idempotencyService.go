@@ -0,0 +1,85 @@
+package idempotencyService
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository/idempotencyRepository"
+)
+
+// Begin reserves key for the user. When the key was already used and its
+// response stored, the stored record is returned with replay set to true.
+// requestHash fingerprints the request body; reusing a key for a different
+// method, path or body returns ErrIdempotencyKeyReused.
+func Begin(db *sql.DB, userID int64, key, method, path, requestHash string, window time.Duration) (*models.IdempotencyRecord, bool, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		id, err := idempotencyRepository.Reserve(db, userID, key, method, path, requestHash, time.Now().Add(window))
+		if err == nil {
+			return &models.IdempotencyRecord{
+				ID:          id,
+				UserID:      userID,
+				Key:         key,
+				Method:      method,
+				Path:        path,
+				RequestHash: requestHash,
+				Status:      models.IdempotencyInProgress,
+			}, false, nil
+		}
+		if !errors.Is(err, idempotencyRepository.ErrKeyExists) {
+			return nil, false, err
+		}
+
+		existing, err := idempotencyRepository.GetByKey(db, userID, key)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			return nil, false, err
+		}
+
+		if existing.ExpiresAt.Before(time.Now()) {
+			if err := idempotencyRepository.Delete(db, existing.ID); err != nil {
+				return nil, false, err
+			}
+			continue
+		}
+		if existing.Method != method || existing.Path != path || existing.RequestHash != requestHash {
+			return nil, false, models.ErrIdempotencyKeyReused
+		}
+		if existing.Status != models.IdempotencyCompleted {
+			return nil, false, models.ErrIdempotencyInFlight
+		}
+		return existing, true, nil
+	}
+	return nil, false, models.ErrIdempotencyInFlight
+}
+
+func Complete(db *sql.DB, record *models.IdempotencyRecord, status int, contentType string, body []byte) error {
+	return idempotencyRepository.Complete(db, record.ID, status, contentType, body)
+}
+
+// Release frees the key so the client can retry, used when the first
+// attempt failed without side effects worth replaying.
+func Release(db *sql.DB, record *models.IdempotencyRecord) error {
+	return idempotencyRepository.Delete(db, record.ID)
+}
+
+func StartPurger(db *sql.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			purged, err := idempotencyRepository.DeleteExpired(db, time.Now())
+			if err != nil {
+				log.Printf("Error purging expired idempotency keys: %v", err)
+				continue
+			}
+			if purged > 0 {
+				log.Printf("Purged %d expired idempotency keys", purged)
+			}
+		}
+	}()
+}
@@ -0,0 +1,218 @@
+package jobService
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository/jobRepository"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/billingService"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/operationService"
+)
+
+const maxErrorLength = 512
+
+var (
+	leaseTimeout = 2 * time.Minute
+	pollInterval = time.Second
+	maxAttempts  = 3
+
+	// wake lets Enqueue start an idle worker on this instance without
+	// waiting for the next poll.
+	wake = make(chan struct{}, 1)
+)
+
+// Configure sets how long a worker may hold a job before another worker
+// reclaims it, how often idle workers poll, and how many times a job is
+// claimed before it is failed.
+func Configure(lease, poll time.Duration, attempts int) {
+	leaseTimeout = lease
+	pollInterval = poll
+	maxAttempts = attempts
+}
+
+// Enqueue holds cost on the user's balance and queues op in the same
+// transaction. The hold is captured or released when a worker finishes.
+func Enqueue(db *sql.DB, userID int64, operation *models.Operation, op operationService.Operation, operands operationService.Operands, cost models.Money) (*models.Job, error) {
+	encoded, err := json.Marshal(operands)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &models.Job{
+		UserID:        userID,
+		OperationID:   operation.ID,
+		OperationType: op.Name(),
+		Operands:      string(encoded),
+		Status:        models.JobQueued,
+		HoldAmount:    cost,
+		HoldStatus:    models.HoldHeld,
+		CreatedAt:     time.Now(),
+	}
+	err = repository.WithTx(db, func(tx *sql.Tx) error {
+		if err := billingService.PlaceHoldTx(tx, userID, cost); err != nil {
+			return err
+		}
+		job.ID, err = jobRepository.CreateJob(tx, job)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// GetJob returns one of the user's jobs.
+func GetJob(db *sql.DB, userID, jobID int64) (*models.Job, error) {
+	job, err := jobRepository.GetJob(db, jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job.UserID != userID {
+		return nil, models.ErrJobNotFound
+	}
+	return job, nil
+}
+
+// StartWorkers runs workers until ctx is cancelled. A worker finishes the
+// job it is running before exiting, so shutdown never abandons a job midway
+// through succeed or fail; the returned function waits for every worker.
+func StartWorkers(ctx context.Context, db *sql.DB, workers int) (wait func()) {
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			work(ctx, db)
+		}()
+	}
+	return wg.Wait
+}
+
+func work(ctx context.Context, db *sql.DB) {
+	for ctx.Err() == nil {
+		processed, err := ProcessNext(db)
+		if err != nil {
+			log.Printf("Error processing job: %v", err)
+		}
+		if processed {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-wake:
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func newLeaseToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ProcessNext claims and runs one job. It reports whether a job was
+// claimed, so callers know to look for more before sleeping.
+func ProcessNext(db *sql.DB) (bool, error) {
+	token, err := newLeaseToken()
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	job, err := jobRepository.ClaimNext(db, token, now, now.Add(leaseTimeout))
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Attempts only grow past one when a worker died holding the lease.
+	if job.Attempts > maxAttempts {
+		return true, fail(db, job, token, fmt.Errorf("job was abandoned %d times", job.Attempts-1))
+	}
+
+	result, response, err := run(job)
+	if err != nil {
+		return true, fail(db, job, token, err)
+	}
+	return true, succeed(db, job, token, result, response)
+}
+
+func run(job *models.Job) (string, string, error) {
+	op, ok := operationService.Lookup(job.OperationType)
+	if !ok {
+		return "", "", errors.New("invalid operation type")
+	}
+	var operands operationService.Operands
+	if err := json.Unmarshal([]byte(job.Operands), &operands); err != nil {
+		return "", "", err
+	}
+
+	value, err := operationService.Evaluate(op, operands)
+	if err != nil {
+		return "", "", err
+	}
+	response, err := operationService.RecordResponse(op, operands, value)
+	if err != nil {
+		return "", "", err
+	}
+	result, err := json.Marshal(value)
+	if err != nil {
+		return "", "", err
+	}
+	return string(result), response, nil
+}
+
+// succeed captures the hold, writing the operation's record, and stores the
+// result. Nothing is committed if the lease was lost to another worker.
+func succeed(db *sql.DB, job *models.Job, token, result, response string) error {
+	return repository.WithTx(db, func(tx *sql.Tx) error {
+		charge, err := billingService.CaptureHoldTx(tx, job.UserID, job.OperationID, job.HoldAmount, response)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		job.Status = models.JobSucceeded
+		job.HoldStatus = models.HoldCaptured
+		job.Result = &result
+		job.RecordID = &charge.RecordID
+		job.FinishedAt = &now
+		return jobRepository.Finish(tx, job, token)
+	})
+}
+
+func fail(db *sql.DB, job *models.Job, token string, cause error) error {
+	message := cause.Error()
+	if len(message) > maxErrorLength {
+		message = message[:maxErrorLength]
+	}
+	return repository.WithTx(db, func(tx *sql.Tx) error {
+		if err := billingService.ReleaseHoldTx(tx, job.UserID, job.HoldAmount); err != nil {
+			return err
+		}
+		now := time.Now()
+		job.Status = models.JobFailed
+		job.HoldStatus = models.HoldReleased
+		job.Error = &message
+		job.FinishedAt = &now
+		return jobRepository.Finish(tx, job, token)
+	})
+}
@@ -0,0 +1,170 @@
+package jobService
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+)
+
+// contains matches a string argument holding substr.
+type contains string
+
+func (c contains) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	return ok && strings.Contains(s, string(c))
+}
+
+func newMock(t *testing.T) (sqlmock.Sqlmock, func() (bool, error)) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return mock, func() (bool, error) { return ProcessNext(db) }
+}
+
+// expectClaim leases job 5 of user 7: addition of 1 and 2, holding 2 credits.
+func expectClaim(mock sqlmock.Sqlmock, attempts int) {
+	mock.ExpectExec(regexp.QuoteMeta("SET status = ?, lease_token = ?, lease_expires_at = ?")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM jobs WHERE lease_token = ? AND status = ?")).
+		WillReturnRows(sqlmock.NewRows(strings.Split(strings.ReplaceAll(
+			"id, user_id, operation_id, operation_type, operands, status, hold_amount, hold_status, result, error, record_id, attempts, lease_token, lease_expires_at, created_at, started_at, finished_at",
+			" ", ""), ",")).
+			AddRow(5, 7, 3, models.OperationAddition, `{"a":1,"b":2}`, models.JobRunning, "2", models.HoldHeld,
+				nil, nil, nil, attempts, "token", now.Add(time.Minute), now, now, nil))
+}
+
+func expectReleaseHold(mock sqlmock.Sqlmock, credits, held, remaining string) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT credits FROM balances WHERE user_id = ? FOR UPDATE")).
+		WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"credits"}).AddRow(credits))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT held_credits FROM balances WHERE user_id = ?")).
+		WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"held_credits"}).AddRow(held))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE balances SET held_credits = ? WHERE user_id = ?")).
+		WithArgs(remaining, 7).WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+// expectCapture releases the 2 credit hold on a balance of 10 and charges
+// it: a record, a balanced ledger pair and the new balance of 8.
+func expectCapture(mock sqlmock.Sqlmock) {
+	expectReleaseHold(mock, "10", "2", "0")
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT credits FROM balances WHERE user_id = ? FOR UPDATE")).
+		WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"credits"}).AddRow("10"))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO records")).
+		WithArgs(3, 7, "2", "8", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(99, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT credits FROM balances WHERE user_id = ? FOR UPDATE")).
+		WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"credits"}).AddRow("10"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT held_credits FROM balances WHERE user_id = ?")).
+		WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"held_credits"}).AddRow("0"))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO ledger_entries")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO ledger_entries")).WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE balances SET credits = ? WHERE user_id = ?")).
+		WithArgs("8", 7).WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func expectFinish(mock sqlmock.Sqlmock, status string, errorMessage interface{}, finished int64) {
+	mock.ExpectExec(regexp.QuoteMeta("SET status = ?, hold_status = ?, result = ?, error = ?")).
+		WithArgs(status, sqlmock.AnyArg(), sqlmock.AnyArg(), errorMessage, sqlmock.AnyArg(), sqlmock.AnyArg(), 5, sqlmock.AnyArg(), models.JobRunning).
+		WillReturnResult(sqlmock.NewResult(0, finished))
+}
+
+func TestProcessNextCapturesHold(t *testing.T) {
+	mock, processNext := newMock(t)
+	expectClaim(mock, 1)
+	mock.ExpectBegin()
+	expectCapture(mock)
+	expectFinish(mock, models.JobSucceeded, nil, 1)
+	mock.ExpectCommit()
+
+	processed, err := processNext()
+	if !processed || err != nil {
+		t.Fatalf("ProcessNext = %v, %v; want the job processed", processed, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// A worker whose lease was reclaimed must not charge the user: the capture
+// and its record are rolled back and the new lease holder finishes the job.
+func TestProcessNextRollsBackCaptureOnLeaseLoss(t *testing.T) {
+	mock, processNext := newMock(t)
+	expectClaim(mock, 1)
+	mock.ExpectBegin()
+	expectCapture(mock)
+	expectFinish(mock, models.JobSucceeded, nil, 0)
+	mock.ExpectRollback()
+
+	processed, err := processNext()
+	if !processed || !errors.Is(err, models.ErrJobLeaseLost) {
+		t.Fatalf("ProcessNext = %v, %v; want ErrJobLeaseLost", processed, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// A job claimed more than maxAttempts times kept killing its workers; it is
+// failed and its hold released without running it again.
+func TestProcessNextFailsAbandonedJob(t *testing.T) {
+	Configure(leaseTimeout, pollInterval, 3)
+	mock, processNext := newMock(t)
+	expectClaim(mock, 4)
+	mock.ExpectBegin()
+	expectReleaseHold(mock, "10", "2", "0")
+	expectFinish(mock, models.JobFailed, contains("abandoned 3 times"), 1)
+	mock.ExpectCommit()
+
+	processed, err := processNext()
+	if !processed || err != nil {
+		t.Fatalf("ProcessNext = %v, %v; want the job failed", processed, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProcessNextIdle(t *testing.T) {
+	mock, processNext := newMock(t)
+	mock.ExpectExec(regexp.QuoteMeta("SET status = ?, lease_token = ?")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if processed, err := processNext(); processed || err != nil {
+		t.Fatalf("ProcessNext = %v, %v; want nothing to do", processed, err)
+	}
+}
+
+func TestWorkersStopOnCancel(t *testing.T) {
+	Configure(leaseTimeout, time.Hour, maxAttempts)
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mock.ExpectExec(regexp.QuoteMeta("SET status = ?, lease_token = ?")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wait := StartWorkers(ctx, db, 1)
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("workers still running after cancel")
+	}
+}
@@ -0,0 +1,329 @@
+package keyManager
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+type Key struct {
+	ID        string
+	Algorithm string
+	// signer is the HMAC secret, *rsa.PrivateKey or ed25519.PrivateKey; nil
+	// for verification-only keys.
+	signer interface{}
+	// verifier is the HMAC secret, *rsa.PublicKey or ed25519.PublicKey.
+	verifier interface{}
+}
+
+func (k *Key) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+type KeyManager struct {
+	signing      *Key
+	verification map[string]*Key
+	Issuer       string
+	Audience     string
+	Leeway       time.Duration
+}
+
+func New(signing *Key, issuer, audience string, leeway time.Duration) *KeyManager {
+	return &KeyManager{
+		signing:      signing,
+		verification: map[string]*Key{signing.ID: signing},
+		Issuer:       issuer,
+		Audience:     audience,
+		Leeway:       leeway,
+	}
+}
+
+// AddVerificationKey accepts tokens signed by a previous key during rotation.
+func (km *KeyManager) AddVerificationKey(key *Key) {
+	km.verification[key.ID] = key
+}
+
+func (km *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(km.signing.method(), claims)
+	token.Header["kid"] = km.signing.ID
+	return token.SignedString(km.signing.signer)
+}
+
+// Keyfunc resolves the verification key from the token's kid and refuses a
+// key whose algorithm differs from the token's, so an RSA public key can
+// never be used as an HMAC secret.
+func (km *KeyManager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := km.verification[kid]
+	if !ok {
+		return nil, errors.New("unknown signing key")
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.verifier, nil
+}
+
+func (km *KeyManager) ValidMethods() []string {
+	seen := map[string]bool{}
+	methods := []string{}
+	for _, key := range km.verification {
+		if !seen[key.Algorithm] {
+			seen[key.Algorithm] = true
+			methods = append(methods, key.Algorithm)
+		}
+	}
+	return methods
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS lists the public verification keys. HMAC secrets are never published.
+func (km *KeyManager) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range km.verification {
+		switch pub := key.verifier.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "RSA",
+				Kid: key.ID,
+				Alg: key.Algorithm,
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "OKP",
+				Kid: key.ID,
+				Alg: key.Algorithm,
+				Use: "sig",
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	return set
+}
+
+func NewHMACKey(id string, secret []byte) (*Key, error) {
+	if len(secret) < 32 {
+		return nil, errors.New("HS256 secret must be at least 32 bytes")
+	}
+	if id == "" {
+		id = keyID(secret)
+	}
+	return &Key{ID: id, Algorithm: AlgHS256, signer: secret, verifier: secret}, nil
+}
+
+// ParsePrivateKey reads a PEM encoded RSA (PKCS#1 or PKCS#8) or Ed25519
+// (PKCS#8) private key.
+func ParsePrivateKey(id string, pemBytes []byte) (*Key, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("no PEM block found in private key")
+	}
+
+	var parsed interface{}
+	var err error
+	if block.Type == "RSA PRIVATE KEY" {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing private key: %v", err)
+	}
+
+	switch private := parsed.(type) {
+	case *rsa.PrivateKey:
+		return newAsymmetricKey(id, AlgRS256, private, &private.PublicKey)
+	case ed25519.PrivateKey:
+		return newAsymmetricKey(id, AlgEdDSA, private, private.Public())
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", parsed)
+	}
+}
+
+// ParsePublicKey reads a PEM encoded RSA or Ed25519 public key used only to
+// verify tokens signed by a retired key.
+func ParsePublicKey(id string, pemBytes []byte) (*Key, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("no PEM block found in public key")
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing public key: %v", err)
+	}
+
+	switch public := parsed.(type) {
+	case *rsa.PublicKey:
+		return newAsymmetricKey(id, AlgRS256, nil, public)
+	case ed25519.PublicKey:
+		return newAsymmetricKey(id, AlgEdDSA, nil, public)
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", parsed)
+	}
+}
+
+func newAsymmetricKey(id, algorithm string, signer interface{}, public crypto.PublicKey) (*Key, error) {
+	if id == "" {
+		der, err := x509.MarshalPKIXPublicKey(public)
+		if err != nil {
+			return nil, err
+		}
+		id = keyID(der)
+	}
+	return &Key{ID: id, Algorithm: algorithm, signer: signer, verifier: public}, nil
+}
+
+func keyID(material []byte) string {
+	sum := sha256.Sum256(material)
+	return hex.EncodeToString(sum[:8])
+}
+
+func readSecretOrFile(valueVar, fileVar string) ([]byte, error) {
+	if path := os.Getenv(fileVar); path != "" {
+		return os.ReadFile(path)
+	}
+	if value := os.Getenv(valueVar); value != "" {
+		return []byte(value), nil
+	}
+	return nil, nil
+}
+
+// LoadFromEnv builds the key manager from JWT_* environment variables:
+//
+//	JWT_ALGORITHM                  HS256 (default), RS256 or EdDSA
+//	JWT_KEY_ID                     kid of the signing key (derived if empty)
+//	JWT_SECRET_KEY / _FILE         HS256 secret, required in production
+//	JWT_PRIVATE_KEY / _FILE        PEM private key for RS256/EdDSA
+//	JWT_VERIFICATION_KEY_FILES     kid=path.pem,... retired public keys
+//	JWT_PREVIOUS_SECRETS           kid=secret,... retired HS256 secrets
+//	JWT_ISSUER, JWT_AUDIENCE       expected iss and aud
+//	JWT_CLOCK_SKEW                 leeway for exp, nbf and iat
+func LoadFromEnv(leeway time.Duration) (*KeyManager, error) {
+	algorithm := os.Getenv("JWT_ALGORITHM")
+	if algorithm == "" {
+		algorithm = AlgHS256
+	}
+	kid := os.Getenv("JWT_KEY_ID")
+
+	var signing *Key
+	switch algorithm {
+	case AlgHS256:
+		secret, err := readSecretOrFile("JWT_SECRET_KEY", "JWT_SECRET_KEY_FILE")
+		if err != nil {
+			return nil, err
+		}
+		if secret == nil && os.Getenv("ENV") == "production" {
+			return nil, errors.New("JWT_SECRET_KEY or JWT_SECRET_KEY_FILE is required when ENV=production")
+		}
+		if secret == nil {
+			log.Println("JWT_SECRET_KEY is not set, using an ephemeral secret: tokens will not survive a restart")
+			secret = make([]byte, 32)
+			if _, err := rand.Read(secret); err != nil {
+				return nil, err
+			}
+		}
+		signing, err = NewHMACKey(kid, secret)
+		if err != nil {
+			return nil, err
+		}
+	case AlgRS256, AlgEdDSA:
+		pemBytes, err := readSecretOrFile("JWT_PRIVATE_KEY", "JWT_PRIVATE_KEY_FILE")
+		if err != nil {
+			return nil, err
+		}
+		if pemBytes == nil {
+			return nil, fmt.Errorf("JWT_PRIVATE_KEY or JWT_PRIVATE_KEY_FILE is required for %s", algorithm)
+		}
+		signing, err = ParsePrivateKey(kid, pemBytes)
+		if err != nil {
+			return nil, err
+		}
+		if signing.Algorithm != algorithm {
+			return nil, fmt.Errorf("JWT_ALGORITHM is %s but the private key is for %s", algorithm, signing.Algorithm)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported JWT_ALGORITHM %q", algorithm)
+	}
+
+	issuer := os.Getenv("JWT_ISSUER")
+	if issuer == "" {
+		issuer = "arithmetic-calculator"
+	}
+	audience := os.Getenv("JWT_AUDIENCE")
+	if audience == "" {
+		audience = "arithmetic-calculator-api"
+	}
+	km := New(signing, issuer, audience, leeway)
+
+	for _, pair := range splitPairs(os.Getenv("JWT_VERIFICATION_KEY_FILES")) {
+		pemBytes, err := os.ReadFile(pair[1])
+		if err != nil {
+			return nil, err
+		}
+		key, err := ParsePublicKey(pair[0], pemBytes)
+		if err != nil {
+			return nil, err
+		}
+		km.AddVerificationKey(key)
+	}
+	for _, pair := range splitPairs(os.Getenv("JWT_PREVIOUS_SECRETS")) {
+		key, err := NewHMACKey(pair[0], []byte(pair[1]))
+		if err != nil {
+			return nil, err
+		}
+		km.AddVerificationKey(key)
+	}
+
+	return km, nil
+}
+
+func splitPairs(value string) [][2]string {
+	var pairs [][2]string
+	for _, item := range strings.Split(value, ",") {
+		id, rest, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if ok && id != "" && rest != "" {
+			pairs = append(pairs, [2]string{id, rest})
+		}
+	}
+	return pairs
+}
@@ -0,0 +1,29 @@
+package keyManager
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadFromEnvRequiresSecretInProduction(t *testing.T) {
+	t.Setenv("JWT_ALGORITHM", "")
+	t.Setenv("JWT_SECRET_KEY", "")
+	t.Setenv("JWT_SECRET_KEY_FILE", "")
+
+	t.Setenv("ENV", "production")
+	if _, err := LoadFromEnv(time.Second); err == nil {
+		t.Fatal("LoadFromEnv without a secret succeeded in production")
+	}
+
+	t.Setenv("ENV", "")
+	if _, err := LoadFromEnv(time.Second); err != nil {
+		t.Fatalf("LoadFromEnv with an ephemeral secret outside production: %v", err)
+	}
+
+	t.Setenv("ENV", "production")
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", 32))
+	if _, err := LoadFromEnv(time.Second); err != nil {
+		t.Fatalf("LoadFromEnv with a secret in production: %v", err)
+	}
+}
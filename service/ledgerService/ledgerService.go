@@ -0,0 +1,138 @@
+package ledgerService
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository/ledgerRepository"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository/userRepository"
+)
+
+// Posting is a change to a user's credits. Amount is signed from the user's
+// point of view: positive for top-ups and refunds, negative for debits.
+type Posting struct {
+	UserID   int64
+	Type     string
+	Amount   models.Money
+	Reason   string
+	RecordID *int64
+	AdminID  *int64
+}
+
+var counterAccounts = map[string]string{
+	models.LedgerTopUp:      models.LedgerAccountTopUps,
+	models.LedgerDebit:      models.LedgerAccountOperationsRevenue,
+	models.LedgerRefund:     models.LedgerAccountOperationsRevenue,
+	models.LedgerAdjustment: models.LedgerAccountAdjustments,
+}
+
+func newTransactionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// PostTx appends a balanced pair of entries for p inside tx: one on the
+// user's credits account carrying the running balance, and the opposite
+// amount on the matching system account. The cached balances.credits is
+// updated under the same row lock.
+func PostTx(tx *sql.Tx, p Posting) (*models.LedgerEntry, error) {
+	counterAccount, ok := counterAccounts[p.Type]
+	if !ok {
+		return nil, errors.New("invalid ledger entry type")
+	}
+	if p.Amount == 0 {
+		return nil, errors.New("ledger amount must not be zero")
+	}
+
+	credits, err := userRepository.GetCreditsForUpdate(tx, p.UserID)
+	if err != nil {
+		return nil, err
+	}
+	balance, err := credits.Add(p.Amount)
+	if err != nil {
+		return nil, err
+	}
+	if balance < 0 {
+		return nil, models.ErrInsufficientCredits
+	}
+	if p.Amount < 0 {
+		// Credits held for queued jobs cannot be spent elsewhere.
+		held, err := userRepository.GetHeldCredits(tx, p.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if balance < held {
+			return nil, models.ErrInsufficientCredits
+		}
+	}
+
+	transactionID, err := newTransactionID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+
+	userID := p.UserID
+	entry := &models.LedgerEntry{
+		TransactionID: transactionID,
+		Account:       models.LedgerAccountUserCredits,
+		UserID:        &userID,
+		Type:          p.Type,
+		Amount:        p.Amount,
+		BalanceAfter:  &balance,
+		Reason:        p.Reason,
+		RecordID:      p.RecordID,
+		AdminID:       p.AdminID,
+		CreatedAt:     now,
+	}
+	entry.ID, err = ledgerRepository.CreateEntry(tx, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	counter := &models.LedgerEntry{
+		TransactionID: transactionID,
+		Account:       counterAccount,
+		Type:          p.Type,
+		Amount:        -p.Amount,
+		Reason:        p.Reason,
+		RecordID:      p.RecordID,
+		AdminID:       p.AdminID,
+		CreatedAt:     now,
+	}
+	if _, err := ledgerRepository.CreateEntry(tx, counter); err != nil {
+		return nil, err
+	}
+
+	if err := userRepository.SetCredits(tx, p.UserID, balance); err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func Post(db *sql.DB, p Posting) (*models.LedgerEntry, error) {
+	var entry *models.LedgerEntry
+	err := repository.WithTx(db, func(tx *sql.Tx) error {
+		var err error
+		entry, err = PostTx(tx, p)
+		return err
+	})
+	return entry, err
+}
+
+func Balance(db *sql.DB, userID int64) (models.Money, error) {
+	return ledgerRepository.SumUserCredits(db, userID)
+}
+
+func GetEntries(db *sql.DB, userID int64, limit, offset int) ([]models.LedgerEntry, int, error) {
+	return ledgerRepository.GetUserEntries(db, userID, limit, offset)
+}
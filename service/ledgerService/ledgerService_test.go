@@ -0,0 +1,141 @@
+package ledgerService
+
+import (
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+)
+
+// capture matches any argument and remembers it.
+type capture struct{ value driver.Value }
+
+func (c *capture) Match(v driver.Value) bool {
+	c.value = v
+	return true
+}
+
+func expectBalance(mock sqlmock.Sqlmock, credits, held string) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT credits FROM balances WHERE user_id = ? FOR UPDATE")).
+		WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"credits"}).AddRow(credits))
+	if held != "" {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT held_credits FROM balances WHERE user_id = ?")).
+			WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"held_credits"}).AddRow(held))
+	}
+}
+
+// expectEntries expects the balanced pair of a posting and the cached
+// balance update, returning the transaction ids both entries were given.
+func expectEntries(mock sqlmock.Sqlmock, entryType, amount, negated, counterAccount, balance string) (*capture, *capture) {
+	userTx, counterTx := &capture{}, &capture{}
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO ledger_entries")).
+		WithArgs(userTx, models.LedgerAccountUserCredits, 7, entryType, amount, balance, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO ledger_entries")).
+		WithArgs(counterTx, counterAccount, nil, entryType, negated, nil, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE balances SET credits = ? WHERE user_id = ?")).
+		WithArgs(balance, 7).WillReturnResult(sqlmock.NewResult(0, 1))
+	return userTx, counterTx
+}
+
+func newMock(t *testing.T) (sqlmock.Sqlmock, func(Posting) (*models.LedgerEntry, error)) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+	return mock, func(p Posting) (*models.LedgerEntry, error) { return Post(db, p) }
+}
+
+func TestPostTopUpWritesBalancedPair(t *testing.T) {
+	mock, post := newMock(t)
+	mock.ExpectBegin()
+	expectBalance(mock, "10", "")
+	userTx, counterTx := expectEntries(mock, models.LedgerTopUp, "5", "-5", models.LedgerAccountTopUps, "15")
+	mock.ExpectCommit()
+
+	entry, err := post(Posting{UserID: 7, Type: models.LedgerTopUp, Amount: 5 * models.MoneyScale, Reason: "top-up"})
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	if entry.BalanceAfter == nil || entry.BalanceAfter.String() != "15" || entry.Account != models.LedgerAccountUserCredits {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+	if userTx.value == nil || userTx.value != counterTx.value {
+		t.Fatalf("entries in transactions %v and %v, want one shared transaction", userTx.value, counterTx.value)
+	}
+}
+
+func TestPostDebitCreditsRevenue(t *testing.T) {
+	mock, post := newMock(t)
+	mock.ExpectBegin()
+	expectBalance(mock, "10", "0")
+	expectEntries(mock, models.LedgerDebit, "-2.5", "2.5", models.LedgerAccountOperationsRevenue, "7.5")
+	mock.ExpectCommit()
+
+	if _, err := post(Posting{UserID: 7, Type: models.LedgerDebit, Amount: -25000, Reason: "charge"}); err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+}
+
+func TestPostRefusesOverdraft(t *testing.T) {
+	mock, post := newMock(t)
+	mock.ExpectBegin()
+	expectBalance(mock, "1", "")
+	mock.ExpectRollback()
+
+	_, err := post(Posting{UserID: 7, Type: models.LedgerDebit, Amount: -2 * models.MoneyScale})
+	if !errors.Is(err, models.ErrInsufficientCredits) {
+		t.Fatalf("Post = %v, want ErrInsufficientCredits", err)
+	}
+}
+
+// Credits held for queued jobs cannot be spent by another debit.
+func TestPostRefusesSpendingHeldCredits(t *testing.T) {
+	mock, post := newMock(t)
+	mock.ExpectBegin()
+	expectBalance(mock, "10", "9")
+	mock.ExpectRollback()
+
+	_, err := post(Posting{UserID: 7, Type: models.LedgerAdjustment, Amount: -2 * models.MoneyScale})
+	if !errors.Is(err, models.ErrInsufficientCredits) {
+		t.Fatalf("Post = %v, want ErrInsufficientCredits", err)
+	}
+}
+
+func TestPostRefusesBalanceOverflow(t *testing.T) {
+	mock, post := newMock(t)
+	mock.ExpectBegin()
+	expectBalance(mock, models.MaxMoney.String(), "")
+	mock.ExpectRollback()
+
+	_, err := post(Posting{UserID: 7, Type: models.LedgerTopUp, Amount: models.MoneyScale})
+	if !errors.Is(err, models.ErrMoneyOutOfRange) {
+		t.Fatalf("Post = %v, want ErrMoneyOutOfRange", err)
+	}
+}
+
+func TestPostRejectsInvalidPostings(t *testing.T) {
+	for _, p := range []Posting{
+		{UserID: 7, Type: models.LedgerTopUp, Amount: 0},
+		{UserID: 7, Type: "gift", Amount: models.MoneyScale},
+	} {
+		mock, post := newMock(t)
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+		if _, err := post(p); err == nil {
+			t.Errorf("Post(%+v) succeeded, want an error", p)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package loginThrottleService
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository/loginThrottleRepository"
+)
+
+const (
+	userKeyPrefix = "user:"
+	ipKeyPrefix   = "ip:"
+)
+
+// Policy controls the backoff applied after failed logins. Each failure
+// blocks the key for BaseDelay doubled per previous failure, up to MaxDelay;
+// reaching the threshold locks it for LockoutDuration. Counters start over
+// once Window passes without failures.
+type Policy struct {
+	UserThreshold   int
+	IPThreshold     int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutDuration time.Duration
+	Window          time.Duration
+}
+
+var DefaultPolicy = Policy{
+	UserThreshold:   5,
+	IPThreshold:     20,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Minute,
+	LockoutDuration: 15 * time.Minute,
+	Window:          15 * time.Minute,
+}
+
+var (
+	policy       = DefaultPolicy
+	store  Store = NewMemoryStore(DefaultPolicy.Window)
+)
+
+func Configure(s Store, p Policy) {
+	store = s
+	policy = p
+}
+
+// LockedError is returned while a username or address is blocked.
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+func UserKey(username string) string {
+	return userKeyPrefix + strings.ToLower(strings.TrimSpace(username))
+}
+
+func IPKey(ip string) string {
+	return ipKeyPrefix + ip
+}
+
+// Check returns a *LockedError when either the username or the address is
+// currently blocked.
+func Check(username, ip string) error {
+	now := time.Now()
+	var retryAfter time.Duration
+	for _, key := range []string{UserKey(username), IPKey(ip)} {
+		throttle, err := store.Get(key)
+		if err != nil {
+			return err
+		}
+		if throttle != nil {
+			if wait := throttle.LockedUntil.Sub(now); wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+	}
+	if retryAfter > 0 {
+		return &LockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+func delayAfter(failures, threshold int) time.Duration {
+	if failures >= threshold {
+		return policy.LockoutDuration
+	}
+	delay := policy.BaseDelay
+	for i := 1; i < failures && delay < policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+	return delay
+}
+
+func recordFailure(key string, threshold int, now time.Time) error {
+	_, err := store.Update(key, func(current models.LoginThrottle) models.LoginThrottle {
+		if now.Sub(current.LastFailureAt) > policy.Window {
+			current.Failures = 0
+		}
+		current.Failures++
+		current.LastFailureAt = now
+		current.LockedUntil = now.Add(delayAfter(current.Failures, threshold))
+		return current
+	})
+	return err
+}
+
+// RecordFailure writes an audit row and, for wrong credentials, advances the
+// username and address counters. Attempts refused while locked are audited
+// without extending the lockout.
+func RecordFailure(db *sql.DB, username, ip, reason string) error {
+	if err := loginThrottleRepository.InsertFailure(db, strings.TrimSpace(username), ip, reason); err != nil {
+		log.Printf("Error auditing failed login: %v", err)
+	}
+	if reason != models.LoginFailureInvalidCredentials {
+		return nil
+	}
+
+	now := time.Now()
+	if err := recordFailure(UserKey(username), policy.UserThreshold, now); err != nil {
+		return err
+	}
+	return recordFailure(IPKey(ip), policy.IPThreshold, now)
+}
+
+// RecordSuccess clears the username's counter. The address counter is left
+// alone so one valid account cannot be used to reset it.
+func RecordSuccess(username string) error {
+	return store.Delete(UserKey(username))
+}
+
+func ListLockouts() ([]models.LoginThrottle, error) {
+	return store.ListLocked(time.Now())
+}
+
+func ClearLockout(key string) error {
+	if !strings.HasPrefix(key, userKeyPrefix) && !strings.HasPrefix(key, ipKeyPrefix) {
+		return fmt.Errorf("lockout key must start with %q or %q", userKeyPrefix, ipKeyPrefix)
+	}
+	return store.Delete(key)
+}
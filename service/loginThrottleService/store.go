@@ -0,0 +1,137 @@
+package loginThrottleService
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository/loginThrottleRepository"
+)
+
+// Store keeps failed-login counters. Update must apply fn atomically with
+// respect to other updates of the same key.
+type Store interface {
+	Get(key string) (*models.LoginThrottle, error)
+	Update(key string, fn func(current models.LoginThrottle) models.LoginThrottle) (*models.LoginThrottle, error)
+	Delete(key string) error
+	ListLocked(now time.Time) ([]models.LoginThrottle, error)
+}
+
+// memoryStoreSweepSize is how many keys a MemoryStore holds before it drops
+// counters that no longer matter.
+const memoryStoreSweepSize = 10000
+
+// MemoryStore keeps counters in process; use it for single instances.
+type MemoryStore struct {
+	mu       sync.Mutex
+	window   time.Duration
+	counters map[string]models.LoginThrottle
+}
+
+func NewMemoryStore(window time.Duration) *MemoryStore {
+	return &MemoryStore{window: window, counters: map[string]models.LoginThrottle{}}
+}
+
+func (s *MemoryStore) Get(key string) (*models.LoginThrottle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	throttle, ok := s.counters[key]
+	if !ok {
+		return nil, nil
+	}
+	return &throttle, nil
+}
+
+func (s *MemoryStore) Update(key string, fn func(current models.LoginThrottle) models.LoginThrottle) (*models.LoginThrottle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.counters) >= memoryStoreSweepSize {
+		s.sweep(time.Now())
+	}
+
+	current, ok := s.counters[key]
+	if !ok {
+		current = models.LoginThrottle{Key: key}
+	}
+	updated := fn(current)
+	s.counters[key] = updated
+	return &updated, nil
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, throttle := range s.counters {
+		if now.After(throttle.LockedUntil) && now.Sub(throttle.LastFailureAt) > s.window {
+			delete(s.counters, key)
+		}
+	}
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.counters, key)
+	return nil
+}
+
+func (s *MemoryStore) ListLocked(now time.Time) ([]models.LoginThrottle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	locked := []models.LoginThrottle{}
+	for _, throttle := range s.counters {
+		if throttle.LockedUntil.After(now) {
+			locked = append(locked, throttle)
+		}
+	}
+	sort.Slice(locked, func(i, j int) bool { return locked[i].LockedUntil.After(locked[j].LockedUntil) })
+	return locked, nil
+}
+
+// DatabaseStore keeps counters in login_throttles so every instance behind a
+// load balancer sees the same failures.
+type DatabaseStore struct {
+	db *sql.DB
+}
+
+func NewDatabaseStore(db *sql.DB) *DatabaseStore {
+	return &DatabaseStore{db: db}
+}
+
+func (s *DatabaseStore) Get(key string) (*models.LoginThrottle, error) {
+	throttle, err := loginThrottleRepository.GetThrottle(s.db, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return throttle, err
+}
+
+func (s *DatabaseStore) Update(key string, fn func(current models.LoginThrottle) models.LoginThrottle) (*models.LoginThrottle, error) {
+	var updated models.LoginThrottle
+	err := repository.WithTx(s.db, func(tx *sql.Tx) error {
+		current, err := loginThrottleRepository.GetThrottleForUpdate(tx, key)
+		if err != nil {
+			return err
+		}
+		updated = fn(*current)
+		return loginThrottleRepository.SaveThrottle(tx, &updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (s *DatabaseStore) Delete(key string) error {
+	return loginThrottleRepository.DeleteThrottle(s.db, key)
+}
+
+func (s *DatabaseStore) ListLocked(now time.Time) ([]models.LoginThrottle, error) {
+	return loginThrottleRepository.GetLockedThrottles(s.db, now)
+}
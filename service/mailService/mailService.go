@@ -0,0 +1,94 @@
+package mailService
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+)
+
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers a rendered message. Implementations must be safe for
+// concurrent use.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+var (
+	mailer      Mailer = NewMemoryMailer()
+	fromAddress        = "no-reply@arithmetic-calculator.local"
+)
+
+// SetMailer installs the mailer used by SendTemplate and the address
+// messages are sent from.
+func SetMailer(m Mailer, from string) {
+	mailer = m
+	if from != "" {
+		fromAddress = from
+	}
+}
+
+func Current() Mailer {
+	return mailer
+}
+
+// SendTemplate renders the named template with data and delivers it to to.
+func SendTemplate(to, name string, data interface{}) error {
+	msg, err := Render(name, data)
+	if err != nil {
+		return err
+	}
+	msg.From = fromAddress
+	msg.To = to
+	return mailer.Send(msg)
+}
+
+// LoadFromEnv builds the mailer selected by MAIL_DRIVER: "smtp", "file"
+// (writes .eml files to MAIL_OUTBOX_DIR) or "memory". Outside production
+// "memory" is the default; in production (ENV=production) the driver must
+// be set so verification and reset emails are not silently dropped.
+func LoadFromEnv() (Mailer, error) {
+	driver := os.Getenv("MAIL_DRIVER")
+	if driver == "" && os.Getenv("ENV") == "production" {
+		return nil, errors.New("MAIL_DRIVER is required when ENV=production")
+	}
+	switch driver {
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			return nil, errors.New("SMTP_HOST is required when MAIL_DRIVER=smtp")
+		}
+		port := 587
+		if value := os.Getenv("SMTP_PORT"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid SMTP_PORT %q", value)
+			}
+			port = parsed
+		}
+		return &SMTPMailer{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}, nil
+	case "file":
+		dir := os.Getenv("MAIL_OUTBOX_DIR")
+		if dir == "" {
+			dir = "outbox"
+		}
+		return NewFileMailer(dir)
+	case "", "memory":
+		log.Println("Mail is kept in memory; set MAIL_DRIVER=smtp to deliver it")
+		return NewMemoryMailer(), nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_DRIVER %q", driver)
+	}
+}
@@ -0,0 +1,76 @@
+package mailService
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+)
+
+var ErrQueueFull = errors.New("mail queue is full")
+
+// Queue delivers mail off the request path on a fixed number of workers.
+// It holds at most size pending jobs; past that, Enqueue refuses the job
+// instead of letting a flood of requests pile up goroutines.
+type Queue struct {
+	name string
+	jobs chan func() error
+}
+
+func NewQueue(name string, size int) *Queue {
+	if size < 1 {
+		size = 1
+	}
+	return &Queue{name: name, jobs: make(chan func() error, size)}
+}
+
+// Enqueue schedules job, or returns ErrQueueFull when no room is left.
+func (q *Queue) Enqueue(job func() error) error {
+	select {
+	case q.jobs <- job:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Start runs workers until ctx is cancelled; they then finish the jobs
+// already queued. The returned function blocks until every worker exits.
+func (q *Queue) Start(ctx context.Context, workers int) (wait func()) {
+	if workers < 1 {
+		workers = 1
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	return wg.Wait
+}
+
+func (q *Queue) work(ctx context.Context) {
+	for {
+		select {
+		case job := <-q.jobs:
+			q.run(job)
+		case <-ctx.Done():
+			for {
+				select {
+				case job := <-q.jobs:
+					q.run(job)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (q *Queue) run(job func() error) {
+	if err := job(); err != nil {
+		log.Printf("Error sending %s email: %v", q.name, err)
+	}
+}
@@ -0,0 +1,41 @@
+package mailService
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestQueueDropsWhenFull(t *testing.T) {
+	q := NewQueue("test", 2)
+	for i := 0; i < 2; i++ {
+		if err := q.Enqueue(func() error { return nil }); err != nil {
+			t.Fatalf("Enqueue %d: %v", i, err)
+		}
+	}
+	if err := q.Enqueue(func() error { return nil }); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Enqueue past capacity = %v, want ErrQueueFull", err)
+	}
+}
+
+func TestQueueDrainsOnShutdown(t *testing.T) {
+	q := NewQueue("test", 10)
+	var sent atomic.Int64
+	for i := 0; i < 10; i++ {
+		q.Enqueue(func() error {
+			sent.Add(1)
+			return errors.New("delivery failed")
+		})
+	}
+
+	// Cancelled before the workers start: they must still send what was
+	// queued before exiting.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	q.Start(ctx, 3)()
+
+	if got := sent.Load(); got != 10 {
+		t.Fatalf("sent %d queued emails on shutdown, want 10", got)
+	}
+}
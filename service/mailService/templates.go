@@ -0,0 +1,25 @@
+package mailService
+
+import (
+	"embed"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var templateFiles embed.FS
+
+var templates = template.Must(template.ParseFS(templateFiles, "templates/*.tmpl"))
+
+// Render executes the "<name>_subject" and "<name>_body" templates.
+func Render(name string, data interface{}) (Message, error) {
+	var subject, body strings.Builder
+	if err := templates.ExecuteTemplate(&subject, name+"_subject", data); err != nil {
+		return Message{}, fmt.Errorf("rendering %s subject: %w", name, err)
+	}
+	if err := templates.ExecuteTemplate(&body, name+"_body", data); err != nil {
+		return Message{}, fmt.Errorf("rendering %s body: %w", name, err)
+	}
+	return Message{Subject: strings.TrimSpace(subject.String()), Body: body.String()}, nil
+}
@@ -0,0 +1,249 @@
+package mfaService
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository/mfaRepository"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/keyManager"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// ChallengeTokenType marks the short-lived token handed out between the
+// password step and the code step of a login.
+const ChallengeTokenType = "mfa_challenge"
+
+const recoveryCodeCount = 10
+
+var (
+	keys              *keyManager.KeyManager
+	issuerName        = "Arithmetic Calculator"
+	challengeLifetime = 5 * time.Minute
+)
+
+// Configure sets the keys challenge tokens are signed with, the issuer name
+// shown in authenticator apps and how long a login challenge stays valid.
+func Configure(km *keyManager.KeyManager, issuer string, challengeTTL time.Duration) {
+	keys = km
+	if issuer != "" {
+		issuerName = issuer
+	}
+	challengeLifetime = challengeTTL
+}
+
+func ChallengeLifetime() time.Duration {
+	return challengeLifetime
+}
+
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// recoveryCodeAlphabet has 32 symbols so byte%len is unbiased, and leaves out
+// characters that are easy to misread (i, l, o, 1).
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz023456789"
+
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = recoveryCodeAlphabet[int(b[i])%len(recoveryCodeAlphabet)]
+	}
+	return string(b[:5]) + "-" + string(b[5:]), nil
+}
+
+func IsEnabled(db *sql.DB, userID int64) (bool, error) {
+	mfa, err := mfaRepository.GetMFA(db, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	return mfa.EnabledAt != nil, nil
+}
+
+// Enroll stores a new pending secret and returns it with its provisioning
+// URI. The secret only protects the account once Activate succeeds.
+func Enroll(db *sql.DB, userID int64, username string) (string, string, error) {
+	enabled, err := IsEnabled(db, userID)
+	if err != nil {
+		return "", "", err
+	}
+	if enabled {
+		return "", "", models.ErrMFAAlreadyEnabled
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := mfaRepository.SavePendingSecret(db, userID, secret); err != nil {
+		return "", "", err
+	}
+	return secret, provisioningURI(issuerName, username, secret), nil
+}
+
+// Activate enables two-factor authentication once the user proves their
+// app produces valid codes, and returns the one-time recovery codes. They
+// are only stored hashed, so this is the only time they can be shown.
+func Activate(db *sql.DB, userID int64, code string) ([]string, error) {
+	var codes []string
+	err := repository.WithTx(db, func(tx *sql.Tx) error {
+		mfa, err := mfaRepository.GetMFAForUpdate(tx, userID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return models.ErrMFANotEnrolled
+			}
+			return err
+		}
+		if mfa.EnabledAt != nil {
+			return models.ErrMFAAlreadyEnabled
+		}
+
+		now := time.Now()
+		step, ok := matchStep(mfa.Secret, code, now)
+		if !ok {
+			return models.ErrInvalidMFACode
+		}
+		if err := mfaRepository.Enable(tx, userID, now); err != nil {
+			return err
+		}
+		if err := mfaRepository.SetLastUsedStep(tx, userID, step); err != nil {
+			return err
+		}
+
+		if err := mfaRepository.DeleteRecoveryCodes(tx, userID); err != nil {
+			return err
+		}
+		codes = make([]string, recoveryCodeCount)
+		for i := range codes {
+			if codes[i], err = newRecoveryCode(); err != nil {
+				return err
+			}
+			if err := mfaRepository.CreateRecoveryCode(tx, userID, hashRecoveryCode(codes[i])); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func verify(tx *sql.Tx, userID int64, code, recoveryCode string) error {
+	mfa, err := mfaRepository.GetMFAForUpdate(tx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrMFANotEnrolled
+		}
+		return err
+	}
+	if mfa.EnabledAt == nil {
+		return models.ErrMFANotEnrolled
+	}
+
+	now := time.Now()
+	if recoveryCode != "" {
+		used, err := mfaRepository.UseRecoveryCode(tx, userID, hashRecoveryCode(recoveryCode), now)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return models.ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	step, ok := matchStep(mfa.Secret, code, now)
+	// A code is only accepted once, even inside its validity window.
+	if !ok || (mfa.LastUsedStep != nil && step <= *mfa.LastUsedStep) {
+		return models.ErrInvalidMFACode
+	}
+	return mfaRepository.SetLastUsedStep(tx, userID, step)
+}
+
+// Verify checks a current TOTP code or, when recoveryCode is set, spends one
+// of the user's recovery codes.
+func Verify(db *sql.DB, userID int64, code, recoveryCode string) error {
+	return repository.WithTx(db, func(tx *sql.Tx) error {
+		return verify(tx, userID, code, recoveryCode)
+	})
+}
+
+// Disable turns two-factor authentication off after checking a current code
+// or recovery code.
+func Disable(db *sql.DB, userID int64, code, recoveryCode string) error {
+	return repository.WithTx(db, func(tx *sql.Tx) error {
+		if err := verify(tx, userID, code, recoveryCode); err != nil {
+			return err
+		}
+		if err := mfaRepository.DeleteRecoveryCodes(tx, userID); err != nil {
+			return err
+		}
+		return mfaRepository.DeleteMFA(tx, userID)
+	})
+}
+
+type challengeClaims struct {
+	TokenType string `json:"typ"`
+	jwt.StandardClaims
+}
+
+// IssueChallenge returns the token proving the password step succeeded.
+func IssueChallenge(userID int64) (string, error) {
+	if keys == nil {
+		return "", errors.New("signing keys not configured")
+	}
+	now := time.Now()
+	return keys.Sign(&challengeClaims{
+		TokenType: ChallengeTokenType,
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    keys.Issuer,
+			Audience:  keys.Audience,
+			Subject:   strconv.FormatInt(userID, 10),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(challengeLifetime).Unix(),
+		},
+	})
+}
+
+// ParseChallenge validates a challenge token and returns its user id.
+func ParseChallenge(token string) (int64, error) {
+	if keys == nil {
+		return 0, errors.New("signing keys not configured")
+	}
+
+	claims := &challengeClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods(keys.ValidMethods()), jwt.WithoutClaimsValidation())
+	if _, err := parser.ParseWithClaims(token, claims, keys.Keyfunc); err != nil {
+		return 0, models.ErrInvalidMFAChallenge
+	}
+	now := time.Now().Unix()
+	if claims.TokenType != ChallengeTokenType ||
+		!claims.VerifyExpiresAt(now, true) ||
+		!claims.VerifyIssuer(keys.Issuer, true) ||
+		!claims.VerifyAudience(keys.Audience, true) {
+		return 0, models.ErrInvalidMFAChallenge
+	}
+
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return 0, models.ErrInvalidMFAChallenge
+	}
+	return userID, nil
+}
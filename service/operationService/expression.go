@@ -0,0 +1,443 @@
+package operationService
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+)
+
+type ExpressionError struct {
+	Column  int    `json:"column"`
+	Message string `json:"error"`
+}
+
+func (e *ExpressionError) Error() string {
+	return fmt.Sprintf("%s at column %d", e.Message, e.Column)
+}
+
+const (
+	MaxExpressionLength = 10000
+	MaxExpressionDepth  = 100
+)
+
+type tokenKind int
+
+const (
+	tokenNumber tokenKind = iota
+	tokenIdent
+	tokenOperator
+	tokenLeftParen
+	tokenRightParen
+	tokenEOF
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	column int
+}
+
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	runes := []rune(source)
+	i := 0
+	for i < len(runes) {
+		c := runes[i]
+		column := i + 1
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c) || c == '.':
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			if i < len(runes) && (runes[i] == 'e' || runes[i] == 'E') {
+				j := i + 1
+				if j < len(runes) && (runes[j] == '+' || runes[j] == '-') {
+					j++
+				}
+				if j < len(runes) && unicode.IsDigit(runes[j]) {
+					for j < len(runes) && unicode.IsDigit(runes[j]) {
+						j++
+					}
+					i = j
+				}
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: string(runes[start:i]), column: column})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: string(runes[start:i]), column: column})
+		case c == '+' || c == '-' || c == '*' || c == '/':
+			tokens = append(tokens, token{kind: tokenOperator, text: string(c), column: column})
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLeftParen, text: "(", column: column})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRightParen, text: ")", column: column})
+			i++
+		default:
+			return nil, &ExpressionError{Column: column, Message: fmt.Sprintf("unexpected character %q", c)}
+		}
+	}
+	tokens = append(tokens, token{kind: tokenEOF, column: len(runes) + 1})
+	return tokens, nil
+}
+
+type exprNode interface {
+	eval() (float64, error)
+	evalRat(opts *PrecisionOptions) (*big.Rat, error)
+	usage(counts map[string]int)
+}
+
+type numberNode struct {
+	value  float64
+	text   string
+	column int
+}
+
+func (n *numberNode) eval() (float64, error) {
+	return n.value, nil
+}
+
+func (n *numberNode) evalRat(opts *PrecisionOptions) (*big.Rat, error) {
+	value, err := parseRat(n.text)
+	if errors.Is(err, errNotANumber) {
+		return nil, &ExpressionError{Column: n.column, Message: fmt.Sprintf("invalid number %q", n.text)}
+	}
+	if err != nil {
+		return nil, &ExpressionError{Column: n.column, Message: err.Error()}
+	}
+	return value, nil
+}
+
+func (n *numberNode) usage(counts map[string]int) {}
+
+type negateNode struct {
+	operand exprNode
+}
+
+func (n *negateNode) eval() (float64, error) {
+	v, err := n.operand.eval()
+	if err != nil {
+		return 0, err
+	}
+	return -v, nil
+}
+
+func (n *negateNode) evalRat(opts *PrecisionOptions) (*big.Rat, error) {
+	v, err := n.operand.evalRat(opts)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Rat).Neg(v), nil
+}
+
+func (n *negateNode) usage(counts map[string]int) {
+	n.operand.usage(counts)
+}
+
+type binaryNode struct {
+	operator    string
+	left, right exprNode
+	column      int
+}
+
+func (n *binaryNode) eval() (float64, error) {
+	a, err := n.left.eval()
+	if err != nil {
+		return 0, err
+	}
+	b, err := n.right.eval()
+	if err != nil {
+		return 0, err
+	}
+
+	switch n.operator {
+	case "+":
+		return Addition(a, b), nil
+	case "-":
+		return Subtraction(a, b), nil
+	case "*":
+		return Multiplication(a, b), nil
+	default:
+		result, err := Division(a, b)
+		if err != nil {
+			return 0, &ExpressionError{Column: n.column, Message: err.Error()}
+		}
+		return result, nil
+	}
+}
+
+func (n *binaryNode) evalRat(opts *PrecisionOptions) (*big.Rat, error) {
+	a, err := n.left.evalRat(opts)
+	if err != nil {
+		return nil, err
+	}
+	b, err := n.right.evalRat(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *big.Rat
+	switch n.operator {
+	case "+":
+		result = BigAddition(a, b)
+	case "-":
+		result = BigSubtraction(a, b)
+	case "*":
+		result = BigMultiplication(a, b)
+	default:
+		result, err = BigDivision(a, b)
+	}
+	if err == nil {
+		err = checkRatSize(result)
+	}
+	if err != nil {
+		return nil, &ExpressionError{Column: n.column, Message: err.Error()}
+	}
+	return result, nil
+}
+
+func (n *binaryNode) usage(counts map[string]int) {
+	n.left.usage(counts)
+	n.right.usage(counts)
+	counts[binaryOperations[n.operator]]++
+}
+
+var binaryOperations = map[string]string{
+	"+": models.OperationAddition,
+	"-": models.OperationSubtraction,
+	"*": models.OperationMultiplication,
+	"/": models.OperationDivision,
+}
+
+type callNode struct {
+	function string
+	argument exprNode
+	column   int
+}
+
+func (n *callNode) eval() (float64, error) {
+	a, err := n.argument.eval()
+	if err != nil {
+		return 0, err
+	}
+	result, err := SquareRoot(a)
+	if err != nil {
+		return 0, &ExpressionError{Column: n.column, Message: err.Error()}
+	}
+	return result, nil
+}
+
+func (n *callNode) evalRat(opts *PrecisionOptions) (*big.Rat, error) {
+	a, err := n.argument.evalRat(opts)
+	if err != nil {
+		return nil, err
+	}
+	result, err := BigSquareRoot(a, opts.Digits)
+	if err != nil {
+		return nil, &ExpressionError{Column: n.column, Message: err.Error()}
+	}
+	return result, nil
+}
+
+func (n *callNode) usage(counts map[string]int) {
+	n.argument.usage(counts)
+	counts[functionOperations[n.function]]++
+}
+
+var functionOperations = map[string]string{
+	"sqrt": models.OperationSquareRoot,
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	depth  int
+}
+
+// enter bounds the recursion of nested parentheses, calls and unary signs so
+// a hostile expression cannot exhaust the stack.
+func (p *parser) enter(t token) error {
+	p.depth++
+	if p.depth > MaxExpressionDepth {
+		return &ExpressionError{Column: t.column, Message: fmt.Sprintf("expression nested deeper than %d levels", MaxExpressionDepth)}
+	}
+	return nil
+}
+
+func (p *parser) leave() {
+	p.depth--
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// expression := term (("+" | "-") term)*
+func (p *parser) parseExpression() (exprNode, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t.kind == tokenOperator && (t.text == "+" || t.text == "-"); t = p.peek() {
+		p.next()
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{operator: t.text, left: left, right: right, column: t.column}
+	}
+	return left, nil
+}
+
+// term := unary (("*" | "/") unary)*
+func (p *parser) parseTerm() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t.kind == tokenOperator && (t.text == "*" || t.text == "/"); t = p.peek() {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{operator: t.text, left: left, right: right, column: t.column}
+	}
+	return left, nil
+}
+
+// unary := ("-" | "+") unary | primary
+func (p *parser) parseUnary() (exprNode, error) {
+	t := p.peek()
+	if t.kind == tokenOperator && (t.text == "-" || t.text == "+") {
+		p.next()
+		if err := p.enter(t); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if t.text == "-" {
+			return &negateNode{operand: operand}, nil
+		}
+		return operand, nil
+	}
+	return p.parsePrimary()
+}
+
+// primary := number | ident "(" expression ")" | "(" expression ")"
+func (p *parser) parsePrimary() (exprNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		value, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, &ExpressionError{Column: t.column, Message: fmt.Sprintf("invalid number %q", t.text)}
+		}
+		return &numberNode{value: value, text: t.text, column: t.column}, nil
+	case tokenIdent:
+		name := strings.ToLower(t.text)
+		if _, ok := functionOperations[name]; !ok {
+			return nil, &ExpressionError{Column: t.column, Message: fmt.Sprintf("unknown function %q", t.text)}
+		}
+		if open := p.next(); open.kind != tokenLeftParen {
+			return nil, &ExpressionError{Column: open.column, Message: "expected '(' after function name"}
+		}
+		if err := p.enter(t); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+		argument, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRightParen {
+			return nil, &ExpressionError{Column: closing.column, Message: "expected ')'"}
+		}
+		return &callNode{function: name, argument: argument, column: t.column}, nil
+	case tokenLeftParen:
+		if err := p.enter(t); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+		inner, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRightParen {
+			return nil, &ExpressionError{Column: closing.column, Message: "expected ')'"}
+		}
+		return inner, nil
+	case tokenEOF:
+		return nil, &ExpressionError{Column: t.column, Message: "unexpected end of expression"}
+	default:
+		return nil, &ExpressionError{Column: t.column, Message: fmt.Sprintf("unexpected %q", t.text)}
+	}
+}
+
+type Expression struct {
+	Source string
+	root   exprNode
+}
+
+func ParseExpression(source string) (*Expression, error) {
+	if strings.TrimSpace(source) == "" {
+		return nil, &ExpressionError{Column: 1, Message: "empty expression"}
+	}
+	if len(source) > MaxExpressionLength {
+		return nil, &ExpressionError{Column: 1, Message: fmt.Sprintf("expression exceeds %d bytes", MaxExpressionLength)}
+	}
+
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, &ExpressionError{Column: t.column, Message: fmt.Sprintf("unexpected %q", t.text)}
+	}
+
+	return &Expression{Source: source, root: root}, nil
+}
+
+func (e *Expression) Evaluate() (float64, error) {
+	return e.root.eval()
+}
+
+func (e *Expression) EvaluatePrecise(opts *PrecisionOptions) (*big.Rat, error) {
+	return e.root.evalRat(opts)
+}
+
+// Usage counts how many times each primitive operation is applied.
+func (e *Expression) Usage() map[string]int {
+	counts := map[string]int{}
+	e.root.usage(counts)
+	return counts
+}
@@ -0,0 +1,276 @@
+package operationService
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+)
+
+func TestExpressionEvaluate(t *testing.T) {
+	tests := []struct {
+		source string
+		want   float64
+	}{
+		{"42", 42},
+		{"2 + 3 * 4", 14},
+		{"(2 + 3) * 4", 20},
+		{"2 * 3 + 4", 10},
+		{"10 - 4 - 3", 3},
+		{"64 / 4 / 2", 8},
+		{"10 - 2 * 3 - 1", 3},
+		{"-3", -3},
+		{"--3", 3},
+		{"- - -3", -3},
+		{"+3", 3},
+		{"2 * -3", -6},
+		{"-(2 + 3)", -5},
+		{"-2 * -2", 4},
+		{"sqrt(16)", 4},
+		{"SQRT(16) + 1", 5},
+		{"sqrt(sqrt(16))", 2},
+		{"-sqrt(9) * 2", -6},
+		{"1.5e2 + .5", 150.5},
+		{"  ( ( 7 ) )  ", 7},
+	}
+	for _, tt := range tests {
+		expression, err := ParseExpression(tt.source)
+		if err != nil {
+			t.Errorf("ParseExpression(%q): %v", tt.source, err)
+			continue
+		}
+		got, err := expression.Evaluate()
+		if err != nil {
+			t.Errorf("Evaluate(%q): %v", tt.source, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Evaluate(%q) = %v, want %v", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestExpressionEvaluatePrecise(t *testing.T) {
+	opts := &PrecisionOptions{Digits: 34}
+	tests := []struct{ source, want string }{
+		{"0.1 + 0.2", "0.3"},
+		{"1 / 3 * 3", "1"},
+		{"123456789012345678901234567890 * 10", "1234567890123456789012345678900"},
+		{"10 - 4 - 3", "3"},
+		{"-(1 / 4)", "-0.25"},
+	}
+	for _, tt := range tests {
+		expression, err := ParseExpression(tt.source)
+		if err != nil {
+			t.Errorf("ParseExpression(%q): %v", tt.source, err)
+			continue
+		}
+		value, err := expression.EvaluatePrecise(opts)
+		if err != nil {
+			t.Errorf("EvaluatePrecise(%q): %v", tt.source, err)
+			continue
+		}
+		if got := FormatRat(value, opts); got != tt.want {
+			t.Errorf("EvaluatePrecise(%q) = %s, want %s", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestExpressionErrors(t *testing.T) {
+	tests := []struct {
+		source  string
+		column  int
+		message string
+	}{
+		{"", 1, "empty expression"},
+		{"   ", 1, "empty expression"},
+		{"2 + * 3", 5, `unexpected "*"`},
+		{"2 $ 3", 3, "unexpected character"},
+		{"(1 + 2", 7, "expected ')'"},
+		{"1 + 2)", 6, `unexpected ")"`},
+		{"2 3", 3, `unexpected "3"`},
+		{"1 +", 4, "unexpected end of expression"},
+		{"foo(1)", 1, `unknown function "foo"`},
+		{"sqrt 4", 6, "expected '('"},
+		{"sqrt(4", 7, "expected ')'"},
+		{"1..2", 1, "invalid number"},
+	}
+	for _, tt := range tests {
+		_, err := ParseExpression(tt.source)
+		var exprErr *ExpressionError
+		if !errors.As(err, &exprErr) {
+			t.Errorf("ParseExpression(%q) = %v, want an ExpressionError", tt.source, err)
+			continue
+		}
+		if exprErr.Column != tt.column || !strings.Contains(exprErr.Message, tt.message) {
+			t.Errorf("ParseExpression(%q) = %q at column %d, want %q at column %d",
+				tt.source, exprErr.Message, exprErr.Column, tt.message, tt.column)
+		}
+	}
+}
+
+func TestExpressionEvaluationErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		column int
+	}{
+		{"1 / 0", 3},
+		{"2 + 8 / (4 - 4)", 7},
+		{"1 + sqrt(-1)", 5},
+	}
+	for _, tt := range tests {
+		expression, err := ParseExpression(tt.source)
+		if err != nil {
+			t.Errorf("ParseExpression(%q): %v", tt.source, err)
+			continue
+		}
+		for mode, evaluate := range map[string]func() error{
+			"float": func() error { _, err := expression.Evaluate(); return err },
+			"precise": func() error {
+				_, err := expression.EvaluatePrecise(&PrecisionOptions{Digits: 34})
+				return err
+			},
+		} {
+			var exprErr *ExpressionError
+			if err := evaluate(); !errors.As(err, &exprErr) || exprErr.Column != tt.column {
+				t.Errorf("%s evaluation of %q = %v, want an error at column %d", mode, tt.source, err, tt.column)
+			}
+		}
+	}
+}
+
+func TestExpressionLimits(t *testing.T) {
+	nested := func(depth int) string {
+		return strings.Repeat("(", depth) + "1" + strings.Repeat(")", depth)
+	}
+	calls := func(depth int) string {
+		return strings.Repeat("sqrt(", depth) + "1" + strings.Repeat(")", depth)
+	}
+	signs := func(depth int) string {
+		return strings.Repeat("-", depth) + "1"
+	}
+
+	for _, build := range []func(int) string{nested, calls, signs} {
+		if _, err := ParseExpression(build(MaxExpressionDepth)); err != nil {
+			t.Errorf("ParseExpression at the depth limit: %v", err)
+		}
+		_, err := ParseExpression(build(MaxExpressionDepth + 1))
+		var exprErr *ExpressionError
+		if !errors.As(err, &exprErr) || !strings.Contains(exprErr.Message, "nested deeper") {
+			t.Errorf("ParseExpression past the depth limit = %v, want a nesting error", err)
+		}
+	}
+
+	// A long but flat expression is fine up to the byte limit.
+	flat := strings.Repeat("1+", (MaxExpressionLength-1)/2) + "1"
+	if _, err := ParseExpression(flat); err != nil {
+		t.Errorf("ParseExpression of %d bytes: %v", len(flat), err)
+	}
+	if _, err := ParseExpression(flat + "+1"); err == nil {
+		t.Errorf("ParseExpression of %d bytes succeeded, want a length error", len(flat)+2)
+	}
+}
+
+// Usage drives what an expression is charged, so every primitive applied
+// must be counted exactly once and nothing else counted at all.
+func TestExpressionUsage(t *testing.T) {
+	tests := []struct {
+		source string
+		want   map[string]int
+	}{
+		{"42", map[string]int{}},
+		{"-42", map[string]int{}},
+		{"(((42)))", map[string]int{}},
+		{"1 + 2", map[string]int{models.OperationAddition: 1}},
+		{"1 + 2 + 3 + 4", map[string]int{models.OperationAddition: 3}},
+		{"-(1 - 2)", map[string]int{models.OperationSubtraction: 1}},
+		{"2 * -3", map[string]int{models.OperationMultiplication: 1}},
+		{"sqrt(16)", map[string]int{models.OperationSquareRoot: 1}},
+		{"1 + 2 * 3 - 4 / sqrt(9)", map[string]int{
+			models.OperationAddition:       1,
+			models.OperationSubtraction:    1,
+			models.OperationMultiplication: 1,
+			models.OperationDivision:       1,
+			models.OperationSquareRoot:     1,
+		}},
+		{"sqrt(sqrt(16)) * sqrt(4) * 2", map[string]int{
+			models.OperationSquareRoot:     3,
+			models.OperationMultiplication: 2,
+		}},
+	}
+	for _, tt := range tests {
+		expression, err := ParseExpression(tt.source)
+		if err != nil {
+			t.Errorf("ParseExpression(%q): %v", tt.source, err)
+			continue
+		}
+		got := expression.Usage()
+		if len(got) != len(tt.want) {
+			t.Errorf("Usage(%q) = %v, want %v", tt.source, got, tt.want)
+			continue
+		}
+		for operation, count := range tt.want {
+			if got[operation] != count {
+				t.Errorf("Usage(%q) = %v, want %v", tt.source, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func expectCatalogPrice(mock sqlmock.Sqlmock, operationType, cost, status string) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, type, cost, status FROM operations WHERE type = ?")).
+		WithArgs(operationType).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "cost", "status"}).
+			AddRow(1, operationType, cost, status))
+}
+
+func TestExpressionCost(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mock.MatchExpectationsInOrder(false)
+
+	expectCatalogPrice(mock, models.OperationAddition, "0.5", models.StatusActive)
+	expectCatalogPrice(mock, models.OperationMultiplication, "1.25", models.StatusActive)
+	expectCatalogPrice(mock, models.OperationSquareRoot, "2", models.StatusActive)
+
+	op, _ := Lookup(models.OperationExpression)
+	base := &models.Operation{Type: models.OperationExpression, Cost: models.Money(1000)}
+	operands := operandsOf(t, `{"expression":"1 + 2 + 3 * sqrt(4)"}`)
+
+	cost, err := OperationCost(db, base, op, operands)
+	if err != nil {
+		t.Fatalf("OperationCost: %v", err)
+	}
+	// 0.1 base + 2 additions at 0.5 + 1 multiplication at 1.25 + 1 root at 2.
+	if want := "4.35"; cost.String() != want {
+		t.Fatalf("OperationCost = %s, want %s", cost, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExpressionCostInactivePrimitive(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	expectCatalogPrice(mock, models.OperationDivision, "1", models.StatusInactive)
+
+	op, _ := Lookup(models.OperationExpression)
+	base := &models.Operation{Type: models.OperationExpression, Cost: models.Money(1000)}
+	_, err = OperationCost(db, base, op, operandsOf(t, `{"expression":"1 / 2"}`))
+	if !errors.Is(err, models.ErrOperationInactive) {
+		t.Fatalf("OperationCost = %v, want ErrOperationInactive", err)
+	}
+}
@@ -3,11 +3,12 @@ package operationService
 import (
 	"database/sql"
 	"errors"
-	"io"
+	"fmt"
 	"math"
-	"net/http"
+	"time"
 
 	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository"
 	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository/operationRepository"
 )
 
@@ -37,21 +38,101 @@ func SquareRoot(a float64) (float64, error) {
 	return math.Sqrt(a), nil
 }
 
-func RandomString() (string, error) {
-	response, err := http.Get("https://www.random.org/strings/?num=1&len=10&digits=on&upperalpha=on&loweralpha=on&unique=on&format=plain&rnd=new")
+func GetOperation(db *sql.DB, operationType string) (*models.Operation, error) {
+	return operationRepository.GetOperationFromDB(db, operationType)
+}
+
+func GetCatalog(db *sql.DB) ([]models.Operation, error) {
+	return operationRepository.GetAllOperations(db)
+}
+
+func CreateCatalogOperation(db *sql.DB, adminID int64, operationType string, cost models.Money, status string) (*models.Operation, error) {
+	if _, ok := Lookup(operationType); !ok {
+		return nil, ErrInvalidCatalogEntry(fmt.Sprintf("operation %q is not registered", operationType))
+	}
+	if err := validateCatalogEntry(cost, status); err != nil {
+		return nil, err
+	}
+
+	operation := &models.Operation{Type: operationType, Cost: cost, Status: status}
+	err := repository.WithTx(db, func(tx *sql.Tx) error {
+		var err error
+		operation.ID, err = operationRepository.CreateOperation(tx, operationType, cost, status)
+		if err != nil {
+			return err
+		}
+		return operationRepository.CreatePriceChange(tx, operation.ID, nil, cost, adminID, time.Now())
+	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer response.Body.Close()
+	return operation, nil
+}
+
+// UpdateCatalogOperation changes an operation's cost and/or status. Every
+// cost change is written to operation_price_history in the same transaction.
+func UpdateCatalogOperation(db *sql.DB, adminID, operationID int64, cost *models.Money, status *string) (*models.Operation, error) {
+	var operation *models.Operation
+	err := repository.WithTx(db, func(tx *sql.Tx) error {
+		var err error
+		operation, err = operationRepository.GetOperationByIDForUpdate(tx, operationID)
+		if err != nil {
+			return err
+		}
 
-	randomString, err := io.ReadAll(response.Body)
+		newCost, newStatus := operation.Cost, operation.Status
+		if cost != nil {
+			newCost = *cost
+		}
+		if status != nil {
+			newStatus = *status
+		}
+		if err := validateCatalogEntry(newCost, newStatus); err != nil {
+			return err
+		}
+
+		if newCost != operation.Cost {
+			if err := operationRepository.UpdateOperationCost(tx, operationID, newCost); err != nil {
+				return err
+			}
+			oldCost := operation.Cost
+			if err := operationRepository.CreatePriceChange(tx, operationID, &oldCost, newCost, adminID, time.Now()); err != nil {
+				return err
+			}
+			operation.Cost = newCost
+		}
+
+		if newStatus != operation.Status {
+			if err := operationRepository.UpdateOperationStatus(tx, operationID, newStatus); err != nil {
+				return err
+			}
+			operation.Status = newStatus
+		}
+		return nil
+	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	return operation, nil
+}
 
-	return string(randomString), nil
+func GetPriceHistory(db *sql.DB, operationID int64) ([]models.OperationPriceChange, error) {
+	return operationRepository.GetPriceHistory(db, operationID)
 }
 
-func GetOperation(db *sql.DB, operationType string) (*models.Operation, error) {
-	return operationRepository.GetOperationFromDB(db, operationType)
+func validateCatalogEntry(cost models.Money, status string) error {
+	if cost < 0 {
+		return ErrInvalidCatalogEntry("cost must not be negative")
+	}
+	if status != models.StatusActive && status != models.StatusInactive {
+		return ErrInvalidCatalogEntry("status must be 'active' or 'inactive'")
+	}
+	return nil
+}
+
+// ErrInvalidCatalogEntry reports a catalog change rejected by validation.
+type ErrInvalidCatalogEntry string
+
+func (e ErrInvalidCatalogEntry) Error() string {
+	return string(e)
 }
@@ -0,0 +1,254 @@
+package operationService
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultPrecisionDigits = 34
+	MaxPrecisionDigits     = 1000
+
+	// MaxPreciseExponent bounds the exponent of a precise operand, and
+	// maxPreciseLiteral its length, so parsing cannot expand "1e1000000000"
+	// into a billion digits.
+	MaxPreciseExponent = 1000
+	maxPreciseLiteral  = 2 * MaxPrecisionDigits
+
+	// maxPreciseBits bounds the numerator and denominator of intermediate
+	// expression results, which would otherwise grow with every factor.
+	maxPreciseBits = 1 << 14
+)
+
+var (
+	errNotANumber        = errors.New("not a number")
+	errPreciseOutOfRange = errors.New("result out of range")
+)
+
+var roundingModes = map[string]big.RoundingMode{
+	"half_even": big.ToNearestEven,
+	"half_up":   big.ToNearestAway,
+	"down":      big.ToZero,
+	"up":        big.AwayFromZero,
+	"floor":     big.ToNegativeInf,
+	"ceiling":   big.ToPositiveInf,
+}
+
+// PrecisionOptions selects math/big evaluation: results are rounded to
+// Digits significant decimal digits using Rounding.
+type PrecisionOptions struct {
+	Digits   int
+	Rounding big.RoundingMode
+}
+
+// PreciseOperation is implemented by operations that support the
+// arbitrary-precision mode requested with the "precision" field.
+type PreciseOperation interface {
+	EvaluatePrecise(operands Operands, opts *PrecisionOptions) (string, error)
+}
+
+// Precision reads the optional "precision" request field. It returns nil
+// when the caller did not ask for arbitrary-precision evaluation.
+func (o Operands) Precision() (*PrecisionOptions, error) {
+	if !o.Has("precision") {
+		return nil, nil
+	}
+
+	var raw struct {
+		Digits   int    `json:"digits"`
+		Rounding string `json:"rounding"`
+	}
+	if err := json.Unmarshal(o["precision"], &raw); err != nil {
+		return nil, errors.New(`"precision" must be an object with "digits" and "rounding"`)
+	}
+
+	opts := &PrecisionOptions{Digits: raw.Digits, Rounding: big.ToNearestEven}
+	if opts.Digits == 0 {
+		opts.Digits = DefaultPrecisionDigits
+	}
+	if opts.Digits < 1 || opts.Digits > MaxPrecisionDigits {
+		return nil, fmt.Errorf("precision digits must be between 1 and %d", MaxPrecisionDigits)
+	}
+	if raw.Rounding != "" {
+		mode, ok := roundingModes[raw.Rounding]
+		if !ok {
+			return nil, fmt.Errorf("unknown rounding mode %q", raw.Rounding)
+		}
+		opts.Rounding = mode
+	}
+	return opts, nil
+}
+
+// Rat reads an operand given either as a JSON number or as a numeric string,
+// parsing the literal text so no precision is lost through float64.
+func (o Operands) Rat(name string) (*big.Rat, error) {
+	if !o.Has(name) {
+		return nil, fmt.Errorf("missing operand %q", name)
+	}
+	text := strings.TrimSpace(string(o[name]))
+	if strings.HasPrefix(text, `"`) {
+		if err := json.Unmarshal(o[name], &text); err != nil {
+			return nil, fmt.Errorf("operand %q must be a number", name)
+		}
+	}
+	value, err := parseRat(strings.TrimSpace(text))
+	if errors.Is(err, errNotANumber) {
+		return nil, fmt.Errorf("operand %q must be a number", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("operand %q: %w", name, err)
+	}
+	return value, nil
+}
+
+// parseRat parses a decimal literal after checking its length and exponent.
+func parseRat(text string) (*big.Rat, error) {
+	if len(text) > maxPreciseLiteral {
+		return nil, fmt.Errorf("number exceeds %d characters", maxPreciseLiteral)
+	}
+	if i := strings.LastIndexAny(text, "eEpP"); i >= 0 {
+		exponent, err := strconv.Atoi(text[i+1:])
+		if err != nil || exponent < -MaxPreciseExponent || exponent > MaxPreciseExponent {
+			return nil, fmt.Errorf("number exponent must be between -%d and %d", MaxPreciseExponent, MaxPreciseExponent)
+		}
+	}
+	value, ok := new(big.Rat).SetString(text)
+	if !ok {
+		return nil, errNotANumber
+	}
+	return value, nil
+}
+
+func checkRatSize(x *big.Rat) error {
+	if x.Num().BitLen() > maxPreciseBits || x.Denom().BitLen() > maxPreciseBits {
+		return errPreciseOutOfRange
+	}
+	return nil
+}
+
+func BigAddition(a, b *big.Rat) *big.Rat {
+	return new(big.Rat).Add(a, b)
+}
+
+func BigSubtraction(a, b *big.Rat) *big.Rat {
+	return new(big.Rat).Sub(a, b)
+}
+
+func BigMultiplication(a, b *big.Rat) *big.Rat {
+	return new(big.Rat).Mul(a, b)
+}
+
+func BigDivision(a, b *big.Rat) (*big.Rat, error) {
+	if b.Sign() == 0 {
+		return nil, errors.New("division by zero")
+	}
+	return new(big.Rat).Quo(a, b), nil
+}
+
+func BigSquareRoot(a *big.Rat, digits int) (*big.Rat, error) {
+	if a.Sign() < 0 {
+		return nil, errors.New("negative number")
+	}
+	// Guard bits keep the binary result accurate past the requested digits
+	// so the final decimal rounding is correct.
+	prec := uint(float64(digits)*3.33) + 64
+	root := new(big.Float).SetPrec(prec).SetRat(a)
+	root.Sqrt(root)
+	result, _ := root.Rat(nil)
+	return result, nil
+}
+
+// FormatRat renders value as a plain decimal string. Integers are exact;
+// anything else is rounded to opts.Digits significant digits.
+func FormatRat(value *big.Rat, opts *PrecisionOptions) string {
+	if value.IsInt() {
+		return value.Num().String()
+	}
+
+	abs := new(big.Rat).Abs(value)
+	exponent := decimalExponent(abs)
+	scale := opts.Digits - 1 - exponent
+
+	scaled := new(big.Rat).Mul(value, pow10Rat(scale))
+	digits := roundRat(scaled, opts.Rounding)
+
+	return formatScaled(digits, scale)
+}
+
+// decimalExponent returns floor(log10(x)) for x > 0.
+func decimalExponent(x *big.Rat) int {
+	num := x.Num().String()
+	den := x.Denom().String()
+	exponent := len(num) - len(den)
+	if new(big.Rat).Mul(x, pow10Rat(-exponent)).Cmp(big.NewRat(1, 1)) < 0 {
+		exponent--
+	}
+	return exponent
+}
+
+func pow10Rat(n int) *big.Rat {
+	if n >= 0 {
+		return new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil))
+	}
+	return new(big.Rat).SetFrac(big.NewInt(1), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(-n)), nil))
+}
+
+func roundRat(x *big.Rat, mode big.RoundingMode) *big.Int {
+	quotient, remainder := new(big.Int).QuoRem(x.Num(), x.Denom(), new(big.Int))
+	if remainder.Sign() == 0 {
+		return quotient
+	}
+
+	negative := x.Sign() < 0
+	awayFromZero := false
+	switch mode {
+	case big.ToZero:
+	case big.AwayFromZero:
+		awayFromZero = true
+	case big.ToNegativeInf:
+		awayFromZero = negative
+	case big.ToPositiveInf:
+		awayFromZero = !negative
+	default:
+		twiceRemainder := new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2))
+		switch twiceRemainder.Cmp(x.Denom()) {
+		case 1:
+			awayFromZero = true
+		case 0:
+			awayFromZero = mode == big.ToNearestAway || quotient.Bit(0) == 1
+		}
+	}
+
+	if awayFromZero {
+		if negative {
+			quotient.Sub(quotient, big.NewInt(1))
+		} else {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+	return quotient
+}
+
+func formatScaled(digits *big.Int, scale int) string {
+	sign := ""
+	if digits.Sign() < 0 {
+		sign = "-"
+	}
+	text := new(big.Int).Abs(digits).String()
+
+	if scale <= 0 {
+		return sign + text + strings.Repeat("0", -scale)
+	}
+	if len(text) <= scale {
+		text = strings.Repeat("0", scale-len(text)+1) + text
+	}
+	whole, fraction := text[:len(text)-scale], strings.TrimRight(text[len(text)-scale:], "0")
+	if fraction == "" {
+		return sign + whole
+	}
+	return sign + whole + "." + fraction
+}
@@ -0,0 +1,174 @@
+package operationService
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/randomService"
+)
+
+const (
+	DefaultRandomLength = 10
+	DefaultRandomCount  = 1
+	MaxRandomCount      = 100
+	MaxRandomCharacters = 10000
+	MaxCustomCharset    = 256
+
+	defaultCharset = "digits,upper,lower"
+	customCharset  = "custom"
+)
+
+var charsetClasses = map[string]string{
+	"digits": "0123456789",
+	"upper":  "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"lower":  "abcdefghijklmnopqrstuvwxyz",
+}
+
+// randomUnitBits is the randomness in one unit of random_string pricing:
+// the historical default of ten alphanumeric characters.
+var randomUnitBits = DefaultRandomLength * math.Log2(62)
+
+func optionalInt(operands Operands, name string, fallback int) (int, error) {
+	if !operands.Has(name) {
+		return fallback, nil
+	}
+	value, err := operands.Int(name)
+	if err != nil {
+		return 0, err
+	}
+	if value < math.MinInt32 || value > math.MaxInt32 {
+		return 0, fmt.Errorf("operand %q is out of range", name)
+	}
+	return int(value), nil
+}
+
+func optionalBool(operands Operands, name string, fallback bool) (bool, error) {
+	if !operands.Has(name) {
+		return fallback, nil
+	}
+	return operands.Bool(name)
+}
+
+// randomStringRequest reads the optional "length", "count", "charset" and
+// "characters" operands. charset is a comma-separated list of "digits",
+// "upper", "lower" and "custom", the last adding the runes of characters.
+func randomStringRequest(operands Operands) (randomService.Request, error) {
+	var req randomService.Request
+	var err error
+	if req.Length, err = optionalInt(operands, "length", DefaultRandomLength); err != nil {
+		return req, err
+	}
+	if req.Count, err = optionalInt(operands, "count", DefaultRandomCount); err != nil {
+		return req, err
+	}
+	if req.Length < 1 {
+		return req, errors.New("length must be at least 1")
+	}
+	if req.Count < 1 || req.Count > MaxRandomCount {
+		return req, fmt.Errorf("count must be between 1 and %d", MaxRandomCount)
+	}
+	if req.Length > MaxRandomCharacters || req.Size() > MaxRandomCharacters {
+		return req, fmt.Errorf("length times count must not exceed %d characters", MaxRandomCharacters)
+	}
+
+	charset := defaultCharset
+	if operands.Has("charset") {
+		if charset, err = operands.String("charset"); err != nil {
+			return req, err
+		}
+	}
+
+	seen := map[rune]bool{}
+	add := func(chars string) {
+		for _, c := range chars {
+			if !seen[c] {
+				seen[c] = true
+				req.Alphabet = append(req.Alphabet, c)
+			}
+		}
+	}
+	custom := false
+	for _, class := range strings.Split(charset, ",") {
+		class = strings.TrimSpace(strings.ToLower(class))
+		if class == customCharset {
+			custom = true
+			continue
+		}
+		chars, ok := charsetClasses[class]
+		if !ok {
+			return req, fmt.Errorf("unknown charset %q; use digits, upper, lower or custom", class)
+		}
+		add(chars)
+	}
+	if custom {
+		characters, err := operands.String("characters")
+		if err != nil {
+			return req, errors.New(`charset "custom" requires a "characters" string`)
+		}
+		if len([]rune(characters)) > MaxCustomCharset {
+			return req, fmt.Errorf("characters must not exceed %d characters", MaxCustomCharset)
+		}
+		add(characters)
+	} else if operands.Has("characters") {
+		return req, errors.New(`"characters" is only used with charset "custom"`)
+	}
+	if len(req.Alphabet) < 2 {
+		return req, errors.New("charset must contain at least 2 distinct characters")
+	}
+	return req, nil
+}
+
+type randomStringOperation struct{}
+
+func (randomStringOperation) Name() string       { return models.OperationRandomString }
+func (randomStringOperation) Arity() int         { return 0 }
+func (randomStringOperation) ResultType() string { return ResultTypeString }
+func (randomStringOperation) Async() bool        { return true }
+
+func (randomStringOperation) Params() []models.OperationParam {
+	return []models.OperationParam{
+		{Name: "length", Type: ResultTypeNumber},
+		{Name: "count", Type: ResultTypeNumber},
+		{Name: "charset", Type: ResultTypeString},
+		{Name: "characters", Type: ResultTypeString},
+	}
+}
+
+func (randomStringOperation) Validate(operands Operands) error {
+	_, err := randomStringRequest(operands)
+	return err
+}
+
+// Evaluate returns a string, or a list of strings when count is above one.
+func (randomStringOperation) Evaluate(operands Operands) (interface{}, error) {
+	req, err := randomStringRequest(operands)
+	if err != nil {
+		return nil, err
+	}
+	values, err := randomService.Strings(req)
+	if err != nil {
+		return nil, err
+	}
+	if !operands.Has("count") {
+		return values[0], nil
+	}
+	return values, nil
+}
+
+// Units prices random_string by the bits of randomness requested, in units
+// of ten alphanumeric characters, rounded up.
+func (randomStringOperation) Units(operands Operands) (int64, error) {
+	req, err := randomStringRequest(operands)
+	if err != nil {
+		return 0, err
+	}
+	bits := float64(req.Size()) * math.Log2(float64(len(req.Alphabet)))
+	units := int64(math.Ceil(bits/randomUnitBits - 1e-9))
+	if units < 1 {
+		units = 1
+	}
+	return units, nil
+}
@@ -0,0 +1,478 @@
+package operationService
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository/operationRepository"
+)
+
+const (
+	ResultTypeNumber  = "number"
+	ResultTypeString  = "string"
+	ResultTypeBoolean = "boolean"
+	ResultTypeList    = "list"
+	ResultTypeObject  = "object"
+)
+
+// Operands holds the raw request fields an operation reads its parameters from.
+type Operands map[string]json.RawMessage
+
+func (o Operands) Has(name string) bool {
+	raw, ok := o[name]
+	return ok && string(raw) != "null"
+}
+
+func (o Operands) Float(name string) (float64, error) {
+	if !o.Has(name) {
+		return 0, fmt.Errorf("missing operand %q", name)
+	}
+	var value float64
+	if err := json.Unmarshal(o[name], &value); err == nil {
+		return value, nil
+	}
+	var text string
+	if err := json.Unmarshal(o[name], &text); err == nil {
+		if value, err := strconv.ParseFloat(text, 64); err == nil && !math.IsNaN(value) && !math.IsInf(value, 0) {
+			return value, nil
+		}
+	}
+	return 0, fmt.Errorf("operand %q must be a number", name)
+}
+
+// maxSafeInteger is the largest integer a JSON number holds exactly.
+const maxSafeInteger = 1 << 53
+
+func (o Operands) Int(name string) (int64, error) {
+	value, err := o.Float(name)
+	if err != nil {
+		return 0, err
+	}
+	if value != math.Trunc(value) || math.Abs(value) > maxSafeInteger {
+		return 0, fmt.Errorf("operand %q must be an integer between -2^53 and 2^53", name)
+	}
+	return int64(value), nil
+}
+
+func (o Operands) Bool(name string) (bool, error) {
+	if !o.Has(name) {
+		return false, fmt.Errorf("missing operand %q", name)
+	}
+	var value bool
+	if err := json.Unmarshal(o[name], &value); err != nil {
+		return false, fmt.Errorf("operand %q must be a boolean", name)
+	}
+	return value, nil
+}
+
+func (o Operands) String(name string) (string, error) {
+	if !o.Has(name) {
+		return "", fmt.Errorf("missing operand %q", name)
+	}
+	var value string
+	if err := json.Unmarshal(o[name], &value); err != nil {
+		return "", fmt.Errorf("operand %q must be a string", name)
+	}
+	return value, nil
+}
+
+type Operation interface {
+	Name() string
+	Arity() int
+	Params() []models.OperationParam
+	Validate(operands Operands) error
+	Evaluate(operands Operands) (interface{}, error)
+	ResultType() string
+}
+
+// UsagePricer is implemented by operations billed per primitive operation
+// they use instead of by their own catalog cost alone.
+type UsagePricer interface {
+	Usage(operands Operands) (map[string]int, error)
+}
+
+// UnitPricer is implemented by operations whose catalog cost is charged per
+// unit of work requested rather than once per evaluation.
+type UnitPricer interface {
+	Units(operands Operands) (int64, error)
+}
+
+// ResponseRecorder lets an operation choose what is stored in
+// records.operation_response instead of the formatted result.
+type ResponseRecorder interface {
+	RecordResponse(operands Operands, result interface{}) (string, error)
+}
+
+// AsyncOperation is implemented by slow or external operations that may be
+// queued as a job with ?async=true instead of blocking the request.
+type AsyncOperation interface {
+	Async() bool
+}
+
+func SupportsAsync(op Operation) bool {
+	async, ok := op.(AsyncOperation)
+	return ok && async.Async()
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Operation{}
+)
+
+func Register(op Operation) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, exists := registry[op.Name()]; exists {
+		panic(fmt.Sprintf("operation %q registered twice", op.Name()))
+	}
+	registry[op.Name()] = op
+}
+
+func Lookup(name string) (Operation, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	op, ok := registry[name]
+	return op, ok
+}
+
+func Registered() []Operation {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	ops := make([]Operation, 0, len(registry))
+	for _, op := range registry {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i].Name() < ops[j].Name() })
+	return ops
+}
+
+func numberParams(names ...string) []models.OperationParam {
+	params := make([]models.OperationParam, len(names))
+	for i, name := range names {
+		params[i] = models.OperationParam{Name: name, Type: ResultTypeNumber, Required: true}
+	}
+	return params
+}
+
+var errPrecisionUnsupported = errors.New("operation does not support precision mode")
+
+type binaryOperation struct {
+	name    string
+	fn      func(a, b float64) (float64, error)
+	precise func(a, b *big.Rat) (*big.Rat, error)
+}
+
+func (o binaryOperation) Name() string                    { return o.name }
+func (o binaryOperation) Arity() int                      { return 2 }
+func (o binaryOperation) Params() []models.OperationParam { return numberParams("a", "b") }
+func (o binaryOperation) ResultType() string              { return ResultTypeNumber }
+
+func (o binaryOperation) Validate(operands Operands) error {
+	if _, err := operands.Rat("a"); err != nil {
+		return err
+	}
+	_, err := operands.Rat("b")
+	return err
+}
+
+func (o binaryOperation) Evaluate(operands Operands) (interface{}, error) {
+	a, err := operands.Float("a")
+	if err != nil {
+		return nil, err
+	}
+	b, err := operands.Float("b")
+	if err != nil {
+		return nil, err
+	}
+	return o.fn(a, b)
+}
+
+func (o binaryOperation) EvaluatePrecise(operands Operands, opts *PrecisionOptions) (string, error) {
+	if o.precise == nil {
+		return "", errPrecisionUnsupported
+	}
+	a, err := operands.Rat("a")
+	if err != nil {
+		return "", err
+	}
+	b, err := operands.Rat("b")
+	if err != nil {
+		return "", err
+	}
+	result, err := o.precise(a, b)
+	if err != nil {
+		return "", err
+	}
+	return FormatRat(result, opts), nil
+}
+
+type unaryOperation struct {
+	name    string
+	fn      func(a float64) (float64, error)
+	precise func(a *big.Rat, digits int) (*big.Rat, error)
+}
+
+func (o unaryOperation) Name() string                    { return o.name }
+func (o unaryOperation) Arity() int                      { return 1 }
+func (o unaryOperation) Params() []models.OperationParam { return numberParams("a") }
+func (o unaryOperation) ResultType() string              { return ResultTypeNumber }
+
+func (o unaryOperation) Validate(operands Operands) error {
+	_, err := operands.Rat("a")
+	return err
+}
+
+func (o unaryOperation) Evaluate(operands Operands) (interface{}, error) {
+	a, err := operands.Float("a")
+	if err != nil {
+		return nil, err
+	}
+	return o.fn(a)
+}
+
+func (o unaryOperation) EvaluatePrecise(operands Operands, opts *PrecisionOptions) (string, error) {
+	if o.precise == nil {
+		return "", errPrecisionUnsupported
+	}
+	a, err := operands.Rat("a")
+	if err != nil {
+		return "", err
+	}
+	result, err := o.precise(a, opts.Digits)
+	if err != nil {
+		return "", err
+	}
+	return FormatRat(result, opts), nil
+}
+
+type expressionOperation struct{}
+
+func (expressionOperation) Name() string { return models.OperationExpression }
+func (expressionOperation) Arity() int   { return 1 }
+func (expressionOperation) Params() []models.OperationParam {
+	return []models.OperationParam{{Name: "expression", Type: ResultTypeString, Required: true}}
+}
+func (expressionOperation) ResultType() string { return ResultTypeNumber }
+
+func (expressionOperation) parse(operands Operands) (*Expression, error) {
+	source, err := operands.String("expression")
+	if err != nil {
+		return nil, err
+	}
+	return ParseExpression(source)
+}
+
+func (o expressionOperation) Validate(operands Operands) error {
+	_, err := o.parse(operands)
+	return err
+}
+
+func (o expressionOperation) Evaluate(operands Operands) (interface{}, error) {
+	expression, err := o.parse(operands)
+	if err != nil {
+		return nil, err
+	}
+	return expression.Evaluate()
+}
+
+func (o expressionOperation) EvaluatePrecise(operands Operands, opts *PrecisionOptions) (string, error) {
+	expression, err := o.parse(operands)
+	if err != nil {
+		return "", err
+	}
+	result, err := expression.EvaluatePrecise(opts)
+	if err != nil {
+		return "", err
+	}
+	return FormatRat(result, opts), nil
+}
+
+func (o expressionOperation) Usage(operands Operands) (map[string]int, error) {
+	expression, err := o.parse(operands)
+	if err != nil {
+		return nil, err
+	}
+	return expression.Usage(), nil
+}
+
+func (o expressionOperation) RecordResponse(operands Operands, result interface{}) (string, error) {
+	source, err := operands.String("expression")
+	if err != nil {
+		return "", err
+	}
+	resultString, err := FormatResult(result)
+	if err != nil {
+		return "", err
+	}
+	response, err := json.Marshal(map[string]string{"expression": source, "result": resultString})
+	return string(response), err
+}
+
+func init() {
+	Register(binaryOperation{
+		name:    models.OperationAddition,
+		fn:      func(a, b float64) (float64, error) { return Addition(a, b), nil },
+		precise: func(a, b *big.Rat) (*big.Rat, error) { return BigAddition(a, b), nil },
+	})
+	Register(binaryOperation{
+		name:    models.OperationSubtraction,
+		fn:      func(a, b float64) (float64, error) { return Subtraction(a, b), nil },
+		precise: func(a, b *big.Rat) (*big.Rat, error) { return BigSubtraction(a, b), nil },
+	})
+	Register(binaryOperation{
+		name:    models.OperationMultiplication,
+		fn:      func(a, b float64) (float64, error) { return Multiplication(a, b), nil },
+		precise: func(a, b *big.Rat) (*big.Rat, error) { return BigMultiplication(a, b), nil },
+	})
+	Register(binaryOperation{name: models.OperationDivision, fn: Division, precise: BigDivision})
+	Register(unaryOperation{name: models.OperationSquareRoot, fn: SquareRoot, precise: BigSquareRoot})
+	Register(randomStringOperation{})
+	Register(expressionOperation{})
+}
+
+// Validate checks the operands of op, including the optional precision
+// options, before anything is charged.
+func Validate(op Operation, operands Operands) error {
+	if err := op.Validate(operands); err != nil {
+		return err
+	}
+	opts, err := operands.Precision()
+	if err != nil {
+		return err
+	}
+	if opts != nil {
+		if _, ok := op.(PreciseOperation); !ok {
+			return errPrecisionUnsupported
+		}
+	}
+	return nil
+}
+
+// Evaluate runs op, switching to math/big evaluation when the request asks
+// for a precision; precise results are returned as decimal strings. NaN and
+// infinite results are reported as errors, since JSON cannot carry them.
+func Evaluate(op Operation, operands Operands) (interface{}, error) {
+	opts, err := operands.Precision()
+	if err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		result, err := op.Evaluate(operands)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkFinite(result); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+	precise, ok := op.(PreciseOperation)
+	if !ok {
+		return nil, errPrecisionUnsupported
+	}
+	return precise.EvaluatePrecise(operands, opts)
+}
+
+func FormatResult(result interface{}) (string, error) {
+	switch v := result.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []string:
+		encoded, err := json.Marshal(v)
+		return string(encoded), err
+	default:
+		return "", fmt.Errorf("unsupported result type %T", result)
+	}
+}
+
+func RecordResponse(op Operation, operands Operands, result interface{}) (string, error) {
+	if recorder, ok := op.(ResponseRecorder); ok {
+		return recorder.RecordResponse(operands, result)
+	}
+	return FormatResult(result)
+}
+
+// OperationCost prices one evaluation of op: its catalog cost, times the
+// units requested for unit-priced operations, plus, for operations that
+// report usage, the catalog cost of every primitive used.
+func OperationCost(db *sql.DB, base *models.Operation, op Operation, operands Operands) (models.Money, error) {
+	total := base.Cost
+	if unitPricer, ok := op.(UnitPricer); ok {
+		units, err := unitPricer.Units(operands)
+		if err != nil {
+			return 0, err
+		}
+		total, err = base.Cost.Mul(units)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	pricer, ok := op.(UsagePricer)
+	if !ok {
+		return total, nil
+	}
+
+	usage, err := pricer.Usage(operands)
+	if err != nil {
+		return 0, err
+	}
+	for operationType, count := range usage {
+		operation, err := GetOperation(db, operationType)
+		if errors.Is(err, models.ErrOperationNotFound) || errors.Is(err, models.ErrOperationInactive) {
+			return 0, fmt.Errorf("%w: %s", err, operationType)
+		}
+		if err != nil {
+			return 0, err
+		}
+		cost, err := operation.Cost.Mul(int64(count))
+		if err != nil {
+			return 0, err
+		}
+		if total, err = total.Add(cost); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+// ListOperations describes every registered operation, joined with its
+// catalog row when one exists.
+func ListOperations(db *sql.DB) ([]models.OperationInfo, error) {
+	rows, err := operationRepository.GetAllOperations(db)
+	if err != nil {
+		return nil, err
+	}
+	byType := make(map[string]models.Operation, len(rows))
+	for _, row := range rows {
+		byType[row.Type] = row
+	}
+
+	infos := []models.OperationInfo{}
+	for _, op := range Registered() {
+		operation, ok := byType[op.Name()]
+		if !ok {
+			operation = models.Operation{Type: op.Name()}
+		}
+		infos = append(infos, models.OperationInfo{
+			Operation:  operation,
+			Arity:      op.Arity(),
+			Params:     op.Params(),
+			ResultType: op.ResultType(),
+		})
+	}
+	return infos, nil
+}
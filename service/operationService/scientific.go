@@ -0,0 +1,335 @@
+package operationService
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+)
+
+const (
+	MaxRoundingDecimals = 15
+
+	unitRadians = "radians"
+	unitDegrees = "degrees"
+)
+
+var (
+	errResultOutOfRange = errors.New("result out of range")
+	errResultUndefined  = errors.New("result is undefined")
+)
+
+// checkFinite rejects NaN and ±Inf, which encoding/json cannot represent.
+func checkFinite(result interface{}) error {
+	switch v := result.(type) {
+	case float64:
+		if math.IsNaN(v) {
+			return errResultUndefined
+		}
+		if math.IsInf(v, 0) {
+			return errResultOutOfRange
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := checkFinite(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func Power(a, b float64) (float64, error) {
+	if a == 0 && b < 0 {
+		return 0, errors.New("zero cannot be raised to a negative power")
+	}
+	if a < 0 && b != math.Trunc(b) {
+		return 0, errors.New("negative base requires an integer exponent")
+	}
+	return math.Pow(a, b), nil
+}
+
+// NthRoot returns the real n-th root of a; odd roots of negative numbers
+// are negative.
+func NthRoot(a, n float64) (float64, error) {
+	if n == 0 || n != math.Trunc(n) {
+		return 0, errors.New("root degree must be a non-zero integer")
+	}
+	odd := math.Mod(n, 2) != 0
+	if a < 0 && !odd {
+		return 0, errors.New("even root of a negative number")
+	}
+	if a == 0 && n < 0 {
+		return 0, errors.New("negative root of zero")
+	}
+	root := math.Pow(math.Abs(a), 1/n)
+	// Pow(27, 1/3) is 3.0000000000000004; prefer the exact integer root.
+	if rounded := math.Round(root); math.Pow(rounded, n) == math.Abs(a) {
+		root = rounded
+	}
+	if a < 0 {
+		return -root, nil
+	}
+	return root, nil
+}
+
+// Log returns the logarithm of a in the given base.
+func Log(a, base float64) (float64, error) {
+	if base <= 0 || base == 1 {
+		return 0, errors.New("logarithm base must be positive and not 1")
+	}
+	if a <= 0 {
+		return 0, errors.New("logarithm of a non-positive number")
+	}
+	return math.Log(a) / math.Log(base), nil
+}
+
+func Ln(a float64) (float64, error) {
+	if a <= 0 {
+		return 0, errors.New("logarithm of a non-positive number")
+	}
+	return math.Log(a), nil
+}
+
+func Log10(a float64) (float64, error) {
+	if a <= 0 {
+		return 0, errors.New("logarithm of a non-positive number")
+	}
+	return math.Log10(a), nil
+}
+
+func Exp(a float64) (float64, error) {
+	return math.Exp(a), nil
+}
+
+func Abs(a float64) (float64, error) {
+	return math.Abs(a), nil
+}
+
+// Modulo returns the remainder of a / b, with the sign of a.
+func Modulo(a, b float64) (float64, error) {
+	if b == 0 {
+		return 0, errors.New("modulo by zero")
+	}
+	return math.Mod(a, b), nil
+}
+
+func Acosh(a float64) (float64, error) {
+	if a < 1 {
+		return 0, errors.New("inverse hyperbolic cosine is undefined below 1")
+	}
+	return math.Acosh(a), nil
+}
+
+func Atanh(a float64) (float64, error) {
+	if a <= -1 || a >= 1 {
+		return 0, errors.New("inverse hyperbolic tangent is only defined between -1 and 1")
+	}
+	return math.Atanh(a), nil
+}
+
+func unitOf(operands Operands) (string, error) {
+	if !operands.Has("unit") {
+		return unitRadians, nil
+	}
+	unit, err := operands.String("unit")
+	if err != nil {
+		return "", err
+	}
+	unit = strings.ToLower(unit)
+	if unit != unitRadians && unit != unitDegrees {
+		return "", fmt.Errorf("unit must be %q or %q", unitRadians, unitDegrees)
+	}
+	return unit, nil
+}
+
+// quarterTurns reports how many right angles x degrees is, when it is an
+// exact multiple of 90, so sin, cos and tan can return exact values there.
+func quarterTurns(degrees float64) (int, bool) {
+	turns := degrees / 90
+	if turns != math.Trunc(turns) || math.Abs(turns) > 1<<53 {
+		return 0, false
+	}
+	return int(math.Mod(turns, 4)+4) % 4, true
+}
+
+func Sin(x float64, unit string) (float64, error) {
+	if unit == unitDegrees {
+		if turns, ok := quarterTurns(x); ok {
+			return [4]float64{0, 1, 0, -1}[turns], nil
+		}
+		x = x * math.Pi / 180
+	}
+	return math.Sin(x), nil
+}
+
+func Cos(x float64, unit string) (float64, error) {
+	if unit == unitDegrees {
+		if turns, ok := quarterTurns(x); ok {
+			return [4]float64{1, 0, -1, 0}[turns], nil
+		}
+		x = x * math.Pi / 180
+	}
+	return math.Cos(x), nil
+}
+
+var errTangentUndefined = errors.New("tangent is undefined at odd multiples of 90 degrees (pi/2)")
+
+// Tan rejects odd multiples of pi/2. In radians those are never exact, so
+// angles whose cosine is within rounding error of zero are rejected too.
+func Tan(x float64, unit string) (float64, error) {
+	if unit == unitDegrees {
+		if turns, ok := quarterTurns(x); ok {
+			if turns%2 == 1 {
+				return 0, errTangentUndefined
+			}
+			return 0, nil
+		}
+		x = x * math.Pi / 180
+	}
+	if math.Abs(math.Cos(x)) < 1e-12 {
+		return 0, errTangentUndefined
+	}
+	return math.Tan(x), nil
+}
+
+func fromRadians(x float64, unit string) float64 {
+	if unit == unitDegrees {
+		return x * 180 / math.Pi
+	}
+	return x
+}
+
+func Asin(a float64, unit string) (float64, error) {
+	if a < -1 || a > 1 {
+		return 0, errors.New("inverse sine is only defined between -1 and 1")
+	}
+	return fromRadians(math.Asin(a), unit), nil
+}
+
+func Acos(a float64, unit string) (float64, error) {
+	if a < -1 || a > 1 {
+		return 0, errors.New("inverse cosine is only defined between -1 and 1")
+	}
+	return fromRadians(math.Acos(a), unit), nil
+}
+
+func Atan(a float64, unit string) (float64, error) {
+	return fromRadians(math.Atan(a), unit), nil
+}
+
+// angleOperation is a trigonometric function taking an optional "unit",
+// "radians" (the default) or "degrees", for its argument or, for the
+// inverse functions, its result.
+type angleOperation struct {
+	name string
+	fn   func(a float64, unit string) (float64, error)
+}
+
+func (o angleOperation) Name() string       { return o.name }
+func (o angleOperation) Arity() int         { return 1 }
+func (o angleOperation) ResultType() string { return ResultTypeNumber }
+
+func (o angleOperation) Params() []models.OperationParam {
+	return append(numberParams("a"), models.OperationParam{Name: "unit", Type: ResultTypeString})
+}
+
+func (o angleOperation) Validate(operands Operands) error {
+	if _, err := operands.Float("a"); err != nil {
+		return err
+	}
+	_, err := unitOf(operands)
+	return err
+}
+
+func (o angleOperation) Evaluate(operands Operands) (interface{}, error) {
+	a, err := operands.Float("a")
+	if err != nil {
+		return nil, err
+	}
+	unit, err := unitOf(operands)
+	if err != nil {
+		return nil, err
+	}
+	return o.fn(a, unit)
+}
+
+// roundingOperation rounds "a" to the optional "decimals" places, 0 by
+// default; negative values round to tens, hundreds and so on.
+type roundingOperation struct {
+	name string
+	fn   func(float64) float64
+}
+
+func (o roundingOperation) Name() string       { return o.name }
+func (o roundingOperation) Arity() int         { return 1 }
+func (o roundingOperation) ResultType() string { return ResultTypeNumber }
+
+func (o roundingOperation) Params() []models.OperationParam {
+	return append(numberParams("a"), models.OperationParam{Name: "decimals", Type: ResultTypeNumber})
+}
+
+func decimalsOf(operands Operands) (int, error) {
+	decimals, err := optionalInt(operands, "decimals", 0)
+	if err != nil {
+		return 0, err
+	}
+	if decimals < -MaxRoundingDecimals || decimals > MaxRoundingDecimals {
+		return 0, fmt.Errorf("decimals must be between -%d and %d", MaxRoundingDecimals, MaxRoundingDecimals)
+	}
+	return decimals, nil
+}
+
+func (o roundingOperation) Validate(operands Operands) error {
+	if _, err := operands.Float("a"); err != nil {
+		return err
+	}
+	_, err := decimalsOf(operands)
+	return err
+}
+
+func (o roundingOperation) Evaluate(operands Operands) (interface{}, error) {
+	a, err := operands.Float("a")
+	if err != nil {
+		return nil, err
+	}
+	decimals, err := decimalsOf(operands)
+	if err != nil {
+		return nil, err
+	}
+	scale := math.Pow10(decimals)
+	scaled := a * scale
+	if math.IsInf(scaled, 0) || math.Abs(scaled) >= 1<<53 {
+		// a has no digits beyond the requested decimals.
+		return a, nil
+	}
+	return o.fn(scaled) / scale, nil
+}
+
+func init() {
+	Register(binaryOperation{name: models.OperationPower, fn: Power})
+	Register(binaryOperation{name: models.OperationNthRoot, fn: NthRoot})
+	Register(binaryOperation{name: models.OperationLog, fn: Log})
+	Register(binaryOperation{name: models.OperationModulo, fn: Modulo})
+	Register(unaryOperation{name: models.OperationLn, fn: Ln})
+	Register(unaryOperation{name: models.OperationLog10, fn: Log10})
+	Register(unaryOperation{name: models.OperationExp, fn: Exp})
+	Register(unaryOperation{name: models.OperationAbs, fn: Abs})
+	Register(angleOperation{name: models.OperationSin, fn: Sin})
+	Register(angleOperation{name: models.OperationCos, fn: Cos})
+	Register(angleOperation{name: models.OperationTan, fn: Tan})
+	Register(angleOperation{name: models.OperationAsin, fn: Asin})
+	Register(angleOperation{name: models.OperationAcos, fn: Acos})
+	Register(angleOperation{name: models.OperationAtan, fn: Atan})
+	Register(unaryOperation{name: models.OperationSinh, fn: func(a float64) (float64, error) { return math.Sinh(a), nil }})
+	Register(unaryOperation{name: models.OperationCosh, fn: func(a float64) (float64, error) { return math.Cosh(a), nil }})
+	Register(unaryOperation{name: models.OperationTanh, fn: func(a float64) (float64, error) { return math.Tanh(a), nil }})
+	Register(unaryOperation{name: models.OperationAsinh, fn: func(a float64) (float64, error) { return math.Asinh(a), nil }})
+	Register(unaryOperation{name: models.OperationAcosh, fn: Acosh})
+	Register(unaryOperation{name: models.OperationAtanh, fn: Atanh})
+	Register(roundingOperation{name: models.OperationFloor, fn: math.Floor})
+	Register(roundingOperation{name: models.OperationCeil, fn: math.Ceil})
+	Register(roundingOperation{name: models.OperationRound, fn: math.Round})
+}
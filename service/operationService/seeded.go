@@ -0,0 +1,563 @@
+package operationService
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/randomService"
+)
+
+const (
+	MaxSeedLength    = 256
+	MaxRandomItems   = 1000
+	MaxDice          = 1000
+	MaxDiceSides     = 1000000
+	MinPasswordLen   = 8
+	MaxPasswordLen   = 128
+	DefaultPassword  = 16
+	passwordSymbols  = "!@#$%^&*()-_=+[]{}<>?"
+	ambiguousSymbols = "0O1lI|"
+)
+
+// seedOf reads the optional "seed" operand, a string or an integer.
+func seedOf(operands Operands) (string, bool, error) {
+	if !operands.Has("seed") {
+		return "", false, nil
+	}
+	seed, err := operands.String("seed")
+	if err != nil {
+		value, intErr := operands.Int("seed")
+		if intErr != nil {
+			return "", false, errors.New(`"seed" must be a string or an integer`)
+		}
+		seed = strconv.FormatInt(value, 10)
+	}
+	if seed == "" || len(seed) > MaxSeedLength {
+		return "", false, fmt.Errorf(`"seed" must be between 1 and %d characters`, MaxSeedLength)
+	}
+	return seed, true, nil
+}
+
+// seededOperation is a random operation that takes an optional "seed". With
+// a seed its result is reproducible and the seed is stored in the record;
+// without one it draws from a crypto/rand keyed source.
+type seededOperation struct {
+	name       string
+	params     []models.OperationParam
+	resultType string
+	validate   func(operands Operands) error
+	generate   func(src *randomService.Source, operands Operands) (interface{}, error)
+	// record picks what is stored for result; nil stores the result itself.
+	record func(operands Operands, result interface{}) map[string]interface{}
+}
+
+func (o seededOperation) Name() string       { return o.name }
+func (o seededOperation) ResultType() string { return o.resultType }
+
+func (o seededOperation) Params() []models.OperationParam {
+	return append(o.params, models.OperationParam{Name: "seed", Type: ResultTypeString})
+}
+
+func (o seededOperation) Arity() int {
+	arity := 0
+	for _, param := range o.params {
+		if param.Required {
+			arity++
+		}
+	}
+	return arity
+}
+
+func (o seededOperation) Validate(operands Operands) error {
+	if _, _, err := seedOf(operands); err != nil {
+		return err
+	}
+	return o.validate(operands)
+}
+
+func (o seededOperation) Evaluate(operands Operands) (interface{}, error) {
+	seed, seeded, err := seedOf(operands)
+	if err != nil {
+		return nil, err
+	}
+	var src *randomService.Source
+	if seeded {
+		src = randomService.NewSeededSource(seed)
+	} else if src, err = randomService.NewSecureSource(); err != nil {
+		return nil, err
+	}
+	return o.generate(src, operands)
+}
+
+func (o seededOperation) RecordResponse(operands Operands, result interface{}) (string, error) {
+	fields := map[string]interface{}{"result": result}
+	if o.record != nil {
+		fields = o.record(operands, result)
+	}
+	if seed, seeded, _ := seedOf(operands); seeded {
+		fields["seed"] = seed
+	}
+	response, err := json.Marshal(fields)
+	return string(response), err
+}
+
+func optionalParam(name, paramType string) models.OperationParam {
+	return models.OperationParam{Name: name, Type: paramType}
+}
+
+func requiredParam(name, paramType string) models.OperationParam {
+	return models.OperationParam{Name: name, Type: paramType, Required: true}
+}
+
+func optionalFloat(operands Operands, name string, fallback float64) (float64, error) {
+	if !operands.Has(name) {
+		return fallback, nil
+	}
+	return operands.Float(name)
+}
+
+func countOf(operands Operands) (int, error) {
+	count, err := optionalInt(operands, "count", 1)
+	if err != nil {
+		return 0, err
+	}
+	if count < 1 || count > MaxRandomCount {
+		return 0, fmt.Errorf("count must be between 1 and %d", MaxRandomCount)
+	}
+	return count, nil
+}
+
+func listOf(operands Operands, name string) ([]json.RawMessage, error) {
+	if !operands.Has(name) {
+		return nil, fmt.Errorf("missing operand %q", name)
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(operands[name], &items); err != nil {
+		return nil, fmt.Errorf("operand %q must be a list", name)
+	}
+	if len(items) == 0 || len(items) > MaxRandomItems {
+		return nil, fmt.Errorf("%q must hold between 1 and %d items", name, MaxRandomItems)
+	}
+	return items, nil
+}
+
+// repeat runs draw count times, returning a single value unless the
+// request named a count.
+func repeat(operands Operands, draw func() (interface{}, error)) (interface{}, error) {
+	count, err := countOf(operands)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, count)
+	for i := range values {
+		if values[i], err = draw(); err != nil {
+			return nil, err
+		}
+	}
+	if !operands.Has("count") {
+		return values[0], nil
+	}
+	return values, nil
+}
+
+func integerRange(operands Operands) (int64, int64, error) {
+	min, err := operands.Int("min")
+	if err != nil {
+		return 0, 0, err
+	}
+	max, err := operands.Int("max")
+	if err != nil {
+		return 0, 0, err
+	}
+	if min > max {
+		return 0, 0, errors.New("min must not be greater than max")
+	}
+	return min, max, nil
+}
+
+func floatRange(operands Operands) (float64, float64, error) {
+	min, err := optionalFloat(operands, "min", 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	max, err := optionalFloat(operands, "max", 1)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !(min < max) || math.IsInf(max-min, 0) {
+		return 0, 0, errors.New("min must be less than max")
+	}
+	return min, max, nil
+}
+
+type diceRoll struct {
+	Notation string  `json:"notation"`
+	Rolls    []int64 `json:"rolls"`
+	Modifier int64   `json:"modifier"`
+	Total    int64   `json:"total"`
+}
+
+var diceNotation = regexp.MustCompile(`^(\d*)d(\d+)([+-]\d+)?$`)
+
+// parseDice reads notation such as "3d6+2": the number of dice (default 1),
+// their sides and an optional modifier.
+func parseDice(operands Operands) (int, int64, int64, error) {
+	notation, err := operands.String("notation")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	match := diceNotation.FindStringSubmatch(strings.ToLower(strings.ReplaceAll(notation, " ", "")))
+	if match == nil {
+		return 0, 0, 0, fmt.Errorf("invalid dice notation %q; use e.g. 3d6+2", notation)
+	}
+	dice := 1
+	if match[1] != "" {
+		if dice, err = strconv.Atoi(match[1]); err != nil || dice < 1 || dice > MaxDice {
+			return 0, 0, 0, fmt.Errorf("number of dice must be between 1 and %d", MaxDice)
+		}
+	}
+	sides, err := strconv.ParseInt(match[2], 10, 64)
+	if err != nil || sides < 1 || sides > MaxDiceSides {
+		return 0, 0, 0, fmt.Errorf("dice sides must be between 1 and %d", MaxDiceSides)
+	}
+	var modifier int64
+	if match[3] != "" {
+		modifier, err = strconv.ParseInt(match[3], 10, 64)
+		if err != nil || modifier < -MaxDiceSides || modifier > MaxDiceSides {
+			return 0, 0, 0, fmt.Errorf("dice modifier must be between -%d and %d", MaxDiceSides, MaxDiceSides)
+		}
+	}
+	return dice, sides, modifier, nil
+}
+
+type weightedChoice struct {
+	Value  json.RawMessage `json:"value"`
+	Weight float64         `json:"weight"`
+}
+
+func choicesOf(operands Operands) ([]weightedChoice, float64, error) {
+	items, err := listOf(operands, "choices")
+	if err != nil {
+		return nil, 0, err
+	}
+	choices := make([]weightedChoice, len(items))
+	total := 0.0
+	for i, item := range items {
+		if err := json.Unmarshal(item, &choices[i]); err != nil || choices[i].Value == nil {
+			return nil, 0, errors.New(`each choice must be an object with "value" and "weight"`)
+		}
+		if !(choices[i].Weight > 0) || math.IsInf(choices[i].Weight, 0) {
+			return nil, 0, errors.New("choice weights must be positive numbers")
+		}
+		total += choices[i].Weight
+	}
+	if math.IsInf(total, 0) {
+		return nil, 0, errors.New("choice weights are too large")
+	}
+	return choices, total, nil
+}
+
+func uuidVersion(operands Operands) (int, error) {
+	version, err := optionalInt(operands, "version", 4)
+	if err != nil {
+		return 0, err
+	}
+	if version != 4 && version != 7 {
+		return 0, errors.New("version must be 4 or 7")
+	}
+	if version != 7 && operands.Has("timestamp") {
+		return 0, errors.New(`"timestamp" only applies to version 7`)
+	}
+	return version, nil
+}
+
+// uuidTimestamp is the Unix time in milliseconds of a version 7 UUID: the
+// "timestamp" operand, so seeded UUIDs can be reproduced, or now.
+func uuidTimestamp(operands Operands) (int64, error) {
+	if !operands.Has("timestamp") {
+		return time.Now().UnixMilli(), nil
+	}
+	timestamp, err := operands.Int("timestamp")
+	if err != nil {
+		return 0, err
+	}
+	if timestamp < 0 || timestamp >= 1<<48 {
+		return 0, errors.New("timestamp must be Unix milliseconds")
+	}
+	return timestamp, nil
+}
+
+// newUUID formats 16 random bytes as an RFC 9562 UUID of the given version,
+// putting timestamp in the first 48 bits for version 7.
+func newUUID(src *randomService.Source, version int, timestamp int64) string {
+	var b [16]byte
+	src.Read(b[:])
+	if version == 7 {
+		for i := 0; i < 6; i++ {
+			b[i] = byte(timestamp >> (40 - 8*i))
+		}
+	}
+	b[6] = b[6]&0x0f | byte(version)<<4
+	b[8] = b[8]&0x3f | 0x80
+
+	h := hex.EncodeToString(b[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+type passwordPolicy struct {
+	length  int
+	classes []string
+}
+
+func passwordPolicyOf(operands Operands) (*passwordPolicy, error) {
+	length, err := optionalInt(operands, "length", DefaultPassword)
+	if err != nil {
+		return nil, err
+	}
+	if length < MinPasswordLen || length > MaxPasswordLen {
+		return nil, fmt.Errorf("length must be between %d and %d", MinPasswordLen, MaxPasswordLen)
+	}
+	excludeAmbiguous, err := optionalBool(operands, "exclude_ambiguous", false)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &passwordPolicy{length: length}
+	for _, class := range []struct{ name, chars string }{
+		{"lower", charsetClasses["lower"]},
+		{"upper", charsetClasses["upper"]},
+		{"digits", charsetClasses["digits"]},
+		{"symbols", passwordSymbols},
+	} {
+		enabled, err := optionalBool(operands, class.name, true)
+		if err != nil {
+			return nil, err
+		}
+		if !enabled {
+			continue
+		}
+		chars := class.chars
+		if excludeAmbiguous {
+			chars = strings.Map(func(r rune) rune {
+				if strings.ContainsRune(ambiguousSymbols, r) {
+					return -1
+				}
+				return r
+			}, chars)
+		}
+		policy.classes = append(policy.classes, chars)
+	}
+	if len(policy.classes) == 0 {
+		return nil, errors.New("at least one of lower, upper, digits and symbols must be enabled")
+	}
+	return policy, nil
+}
+
+// generatePassword takes one character from every enabled class, fills the
+// rest from all of them and shuffles the result.
+func generatePassword(src *randomService.Source, policy *passwordPolicy) string {
+	all := strings.Join(policy.classes, "")
+	chars := make([]byte, 0, policy.length)
+	for _, class := range policy.classes {
+		chars = append(chars, class[src.Uint64N(uint64(len(class)))])
+	}
+	for len(chars) < policy.length {
+		chars = append(chars, all[src.Uint64N(uint64(len(all)))])
+	}
+	src.Shuffle(len(chars), func(i, j int) { chars[i], chars[j] = chars[j], chars[i] })
+	return string(chars)
+}
+
+func init() {
+	Register(seededOperation{
+		name:       models.OperationRandomInteger,
+		params:     []models.OperationParam{requiredParam("min", ResultTypeNumber), requiredParam("max", ResultTypeNumber), optionalParam("count", ResultTypeNumber)},
+		resultType: ResultTypeNumber,
+		validate: func(operands Operands) error {
+			if _, _, err := integerRange(operands); err != nil {
+				return err
+			}
+			_, err := countOf(operands)
+			return err
+		},
+		generate: func(src *randomService.Source, operands Operands) (interface{}, error) {
+			min, max, err := integerRange(operands)
+			if err != nil {
+				return nil, err
+			}
+			return repeat(operands, func() (interface{}, error) { return src.IntRange(min, max), nil })
+		},
+	})
+	Register(seededOperation{
+		name:       models.OperationRandomFloat,
+		params:     []models.OperationParam{optionalParam("min", ResultTypeNumber), optionalParam("max", ResultTypeNumber), optionalParam("count", ResultTypeNumber)},
+		resultType: ResultTypeNumber,
+		validate: func(operands Operands) error {
+			if _, _, err := floatRange(operands); err != nil {
+				return err
+			}
+			_, err := countOf(operands)
+			return err
+		},
+		generate: func(src *randomService.Source, operands Operands) (interface{}, error) {
+			min, max, err := floatRange(operands)
+			if err != nil {
+				return nil, err
+			}
+			return repeat(operands, func() (interface{}, error) {
+				value := min + src.Float64()*(max-min)
+				if value >= max {
+					value = math.Nextafter(max, min)
+				}
+				return value, nil
+			})
+		},
+	})
+	Register(seededOperation{
+		name:       models.OperationDiceRoll,
+		params:     []models.OperationParam{requiredParam("notation", ResultTypeString)},
+		resultType: ResultTypeObject,
+		validate: func(operands Operands) error {
+			_, _, _, err := parseDice(operands)
+			return err
+		},
+		generate: func(src *randomService.Source, operands Operands) (interface{}, error) {
+			dice, sides, modifier, err := parseDice(operands)
+			if err != nil {
+				return nil, err
+			}
+			roll := &diceRoll{Modifier: modifier, Total: modifier, Rolls: make([]int64, dice)}
+			roll.Notation, _ = operands.String("notation")
+			for i := range roll.Rolls {
+				roll.Rolls[i] = src.IntRange(1, sides)
+				roll.Total += roll.Rolls[i]
+			}
+			return roll, nil
+		},
+	})
+	Register(seededOperation{
+		name:       models.OperationShuffle,
+		params:     []models.OperationParam{requiredParam("items", ResultTypeList)},
+		resultType: ResultTypeList,
+		validate: func(operands Operands) error {
+			_, err := listOf(operands, "items")
+			return err
+		},
+		generate: func(src *randomService.Source, operands Operands) (interface{}, error) {
+			items, err := listOf(operands, "items")
+			if err != nil {
+				return nil, err
+			}
+			src.Shuffle(len(items), func(i, j int) { items[i], items[j] = items[j], items[i] })
+			return items, nil
+		},
+	})
+	Register(seededOperation{
+		name:       models.OperationWeightedChoice,
+		params:     []models.OperationParam{requiredParam("choices", ResultTypeList), optionalParam("count", ResultTypeNumber)},
+		resultType: ResultTypeString,
+		validate: func(operands Operands) error {
+			if _, _, err := choicesOf(operands); err != nil {
+				return err
+			}
+			_, err := countOf(operands)
+			return err
+		},
+		generate: func(src *randomService.Source, operands Operands) (interface{}, error) {
+			choices, total, err := choicesOf(operands)
+			if err != nil {
+				return nil, err
+			}
+			// Picks the first choice whose cumulative weight exceeds a
+			// uniform draw in [0, total).
+			return repeat(operands, func() (interface{}, error) {
+				target := src.Float64() * total
+				cumulative := 0.0
+				for _, choice := range choices {
+					cumulative += choice.Weight
+					if target < cumulative {
+						return choice.Value, nil
+					}
+				}
+				return choices[len(choices)-1].Value, nil
+			})
+		},
+	})
+	Register(seededOperation{
+		name:       models.OperationUUID,
+		params:     []models.OperationParam{optionalParam("version", ResultTypeNumber), optionalParam("timestamp", ResultTypeNumber), optionalParam("count", ResultTypeNumber)},
+		resultType: ResultTypeString,
+		validate: func(operands Operands) error {
+			if _, err := uuidVersion(operands); err != nil {
+				return err
+			}
+			if _, err := uuidTimestamp(operands); err != nil {
+				return err
+			}
+			_, err := countOf(operands)
+			return err
+		},
+		generate: func(src *randomService.Source, operands Operands) (interface{}, error) {
+			version, err := uuidVersion(operands)
+			if err != nil {
+				return nil, err
+			}
+			timestamp, err := uuidTimestamp(operands)
+			if err != nil {
+				return nil, err
+			}
+			return repeat(operands, func() (interface{}, error) { return newUUID(src, version, timestamp), nil })
+		},
+		// Version 7 UUIDs also depend on the clock, so the timestamp used
+		// is recorded next to the seed.
+		record: func(operands Operands, result interface{}) map[string]interface{} {
+			fields := map[string]interface{}{"result": result}
+			if version, _ := uuidVersion(operands); version == 7 {
+				first, _ := result.(string)
+				if values, ok := result.([]interface{}); ok && len(values) > 0 {
+					first, _ = values[0].(string)
+				}
+				if timestamp, err := strconv.ParseInt(strings.ReplaceAll(first, "-", "")[:12], 16, 64); err == nil {
+					fields["timestamp"] = timestamp
+				}
+			}
+			return fields
+		},
+	})
+	Register(seededOperation{
+		name: models.OperationPassword,
+		params: []models.OperationParam{
+			optionalParam("length", ResultTypeNumber),
+			optionalParam("lower", ResultTypeBoolean),
+			optionalParam("upper", ResultTypeBoolean),
+			optionalParam("digits", ResultTypeBoolean),
+			optionalParam("symbols", ResultTypeBoolean),
+			optionalParam("exclude_ambiguous", ResultTypeBoolean),
+		},
+		resultType: ResultTypeString,
+		validate: func(operands Operands) error {
+			_, err := passwordPolicyOf(operands)
+			return err
+		},
+		generate: func(src *randomService.Source, operands Operands) (interface{}, error) {
+			policy, err := passwordPolicyOf(operands)
+			if err != nil {
+				return nil, err
+			}
+			return generatePassword(src, policy), nil
+		},
+		// Generated passwords are never written to the records table.
+		record: func(operands Operands, result interface{}) map[string]interface{} {
+			password, _ := result.(string)
+			return map[string]interface{}{"length": len(password)}
+		},
+	})
+}
@@ -0,0 +1,133 @@
+package operationService
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func operandsOf(t *testing.T, body string) Operands {
+	t.Helper()
+	var operands Operands
+	if err := json.Unmarshal([]byte(body), &operands); err != nil {
+		t.Fatalf("invalid operands %s: %v", body, err)
+	}
+	return operands
+}
+
+func evaluateJSON(t *testing.T, name, body string) (string, error) {
+	t.Helper()
+	op, ok := Lookup(name)
+	if !ok {
+		t.Fatalf("operation %q is not registered", name)
+	}
+	operands := operandsOf(t, body)
+	if err := Validate(op, operands); err != nil {
+		return "", err
+	}
+	result, err := Evaluate(op, operands)
+	if err != nil {
+		return "", err
+	}
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("encoding %v: %v", result, err)
+	}
+	return string(encoded), nil
+}
+
+// Seeded results are promised to be reproducible across instances and
+// releases, so each operation's output for a fixed seed is pinned here.
+func TestSeededOperationsAreReproducible(t *testing.T) {
+	tests := []struct {
+		op, operands, want string
+	}{
+		{"random_integer", `{"min":1,"max":100,"seed":"abc"}`, `13`},
+		{"random_integer", `{"min":-5,"max":5,"count":5,"seed":42}`, `[0,5,0,-5,3]`},
+		{"random_float", `{"seed":"abc"}`, `0.32209575069489504`},
+		{"random_float", `{"min":10,"max":20,"count":3,"seed":"abc"}`, `[13.22095750694895,10.031848913609943,16.47900463206732]`},
+		{"dice_roll", `{"notation":"3d6+2","seed":"abc"}`, `{"notation":"3d6+2","rolls":[5,6,2],"modifier":2,"total":15}`},
+		{"shuffle", `{"items":[1,2,3,4,5,"a"],"seed":"abc"}`, `[2,"a",1,4,3,5]`},
+		{"weighted_choice", `{"choices":[{"value":"x","weight":1},{"value":"y","weight":3}],"count":5,"seed":"abc"}`, `["y","x","y","y","y"]`},
+		{"uuid", `{"seed":"abc"}`, `"f8da466a-fbdd-4452-a9de-9d3c9cb9d000"`},
+		{"uuid", `{"version":7,"timestamp":1700000000000,"seed":"abc"}`, `"018bcfe5-6800-7452-a9de-9d3c9cb9d000"`},
+		{"password", `{"length":12,"seed":"abc"}`, `"0k?se95uD!ho"`},
+		{"password", `{"length":10,"symbols":false,"exclude_ambiguous":true,"seed":"abc"}`, `"PuQTywGc9n"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.op, func(t *testing.T) {
+			got, err := evaluateJSON(t, tt.op, tt.operands)
+			if err != nil {
+				t.Fatalf("%s %s: %v", tt.op, tt.operands, err)
+			}
+			if got != tt.want {
+				t.Fatalf("%s %s = %s, want %s", tt.op, tt.operands, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnseededOperationsVary(t *testing.T) {
+	first, err := evaluateJSON(t, "uuid", `{}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := evaluateJSON(t, "uuid", `{}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Fatalf("two unseeded UUIDs were both %s", first)
+	}
+}
+
+func TestSeededRecordResponse(t *testing.T) {
+	op, _ := Lookup("random_integer")
+	operands := operandsOf(t, `{"min":1,"max":100,"seed":"abc"}`)
+	result, err := Evaluate(op, operands)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := RecordResponse(op, operands, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response != `{"result":13,"seed":"abc"}` {
+		t.Fatalf("record response = %s", response)
+	}
+
+	op, _ = Lookup("password")
+	operands = operandsOf(t, `{"length":12,"seed":"abc"}`)
+	result, err = Evaluate(op, operands)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err = RecordResponse(op, operands, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(response, result.(string)) {
+		t.Fatalf("password was stored in the record: %s", response)
+	}
+}
+
+func TestSeededOperationValidation(t *testing.T) {
+	tests := []struct{ op, operands string }{
+		{"random_integer", `{"min":5,"max":1}`},
+		{"random_integer", `{"min":1,"max":2,"seed":""}`},
+		{"random_float", `{"min":1,"max":1}`},
+		{"dice_roll", `{"notation":"d0"}`},
+		{"dice_roll", `{"notation":"1001d6"}`},
+		{"shuffle", `{"items":[]}`},
+		{"weighted_choice", `{"choices":[{"value":"x","weight":0}]}`},
+		{"uuid", `{"version":5}`},
+		{"uuid", `{"version":4,"timestamp":1}`},
+		{"password", `{"length":4}`},
+		{"password", `{"lower":false,"upper":false,"digits":false,"symbols":false}`},
+	}
+	for _, tt := range tests {
+		if _, err := evaluateJSON(t, tt.op, tt.operands); err == nil {
+			t.Errorf("%s %s: want a validation error", tt.op, tt.operands)
+		}
+	}
+}
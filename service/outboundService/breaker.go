@@ -0,0 +1,112 @@
+package outboundService
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half_open"
+)
+
+// Status is a snapshot of one dependency's breaker and call counters.
+type Status struct {
+	Name                string     `json:"name"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Requests            int64      `json:"requests"`
+	Failures            int64      `json:"failures"`
+	Rejected            int64      `json:"rejected"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	LastFailureAt       *time.Time `json:"last_failure_at,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+}
+
+// breaker opens after threshold consecutive failures. Once openTimeout has
+// passed a single trial call is allowed: success closes the breaker, failure
+// opens it again.
+type breaker struct {
+	threshold   int
+	openTimeout time.Duration
+
+	mu            sync.Mutex
+	state         string
+	failures      int
+	openedAt      time.Time
+	trialInFlight bool
+
+	requests, failed, rejected int64
+	lastFailureAt              time.Time
+	lastError                  string
+}
+
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen && time.Since(b.openedAt) >= b.openTimeout {
+		b.state = StateHalfOpen
+		b.trialInFlight = false
+	}
+	if b.state == StateOpen || (b.state == StateHalfOpen && b.trialInFlight) {
+		b.rejected++
+		return false
+	}
+	if b.state == StateHalfOpen {
+		b.trialInFlight = true
+	}
+	b.requests++
+	return true
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = StateClosed
+	b.failures = 0
+	b.trialInFlight = false
+}
+
+func (b *breaker) failure(reason string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failed++
+	b.failures++
+	b.lastFailureAt = time.Now()
+	b.lastError = reason
+	if b.state == StateHalfOpen || (b.threshold > 0 && b.failures >= b.threshold) {
+		b.state = StateOpen
+		b.openedAt = b.lastFailureAt
+		b.trialInFlight = false
+	}
+}
+
+func (b *breaker) status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := Status{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		Requests:            b.requests,
+		Failures:            b.failed,
+		Rejected:            b.rejected,
+		LastError:           b.lastError,
+	}
+	if b.state == StateOpen && time.Since(b.openedAt) >= b.openTimeout {
+		status.State = StateHalfOpen
+	}
+	if b.state != StateClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	if !b.lastFailureAt.IsZero() {
+		lastFailureAt := b.lastFailureAt
+		status.LastFailureAt = &lastFailureAt
+	}
+	return status
+}
@@ -0,0 +1,207 @@
+package outboundService
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	mathrand "math/rand/v2"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const maxResponseBytes = 1 << 20
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// Policy controls how calls to one dependency are made: each attempt is cut
+// off after Timeout, failures are retried up to MaxRetries times with full
+// jitter backoff, and after FailureThreshold consecutive failures the
+// breaker opens and calls fail fast for OpenTimeout before one trial call is
+// let through.
+type Policy struct {
+	Timeout          time.Duration
+	MaxRetries       int
+	BaseBackoff      time.Duration
+	MaxBackoff       time.Duration
+	FailureThreshold int
+	OpenTimeout      time.Duration
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		Timeout:          5 * time.Second,
+		MaxRetries:       2,
+		BaseBackoff:      200 * time.Millisecond,
+		MaxBackoff:       2 * time.Second,
+		FailureThreshold: 5,
+		OpenTimeout:      30 * time.Second,
+	}
+}
+
+type Response struct {
+	StatusCode int
+	Body       []byte
+}
+
+// Client is an HTTP client for one named dependency. It is safe for
+// concurrent use.
+type Client struct {
+	name    string
+	policy  Policy
+	http    *http.Client
+	breaker *breaker
+
+	// IsFailure decides which responses count against the breaker and are
+	// retried; by default server errors and 429.
+	IsFailure func(resp *Response) bool
+}
+
+var (
+	clientsMu sync.RWMutex
+	clients   = map[string]*Client{}
+)
+
+// New creates the client for a dependency and registers it for Statuses,
+// replacing any earlier client of the same name.
+func New(name string, policy Policy) *Client {
+	c := &Client{
+		name:      name,
+		policy:    policy,
+		http:      &http.Client{Timeout: policy.Timeout},
+		breaker:   &breaker{threshold: policy.FailureThreshold, openTimeout: policy.OpenTimeout, state: StateClosed},
+		IsFailure: defaultIsFailure,
+	}
+	clientsMu.Lock()
+	clients[name] = c
+	clientsMu.Unlock()
+	return c
+}
+
+func defaultIsFailure(resp *Response) bool {
+	return resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests
+}
+
+func (c *Client) Name() string {
+	return c.name
+}
+
+// backoff returns a random wait in [0, min(MaxBackoff, BaseBackoff*2^retry)).
+func (c *Client) backoff(retry int) time.Duration {
+	ceiling := c.policy.BaseBackoff << retry
+	if ceiling <= 0 || ceiling > c.policy.MaxBackoff {
+		ceiling = c.policy.MaxBackoff
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(mathrand.Int64N(int64(ceiling)))
+}
+
+// Get fetches url. Any response is returned once an attempt succeeds or the
+// retries run out; an error means no response was obtained, either because
+// every attempt failed in transport or because the breaker is open.
+func (c *Client) Get(url string) (*Response, error) {
+	var resp *Response
+	var err error
+	for attempt := 0; attempt <= c.policy.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(c.backoff(attempt - 1))
+		}
+		if !c.breaker.allow() {
+			if resp != nil {
+				return resp, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w (last error: %v)", c.name, ErrCircuitOpen, err)
+			}
+			return nil, fmt.Errorf("%s: %w", c.name, ErrCircuitOpen)
+		}
+
+		resp, err = c.getOnce(url)
+		switch {
+		case err != nil:
+			c.breaker.failure(err.Error())
+		case c.IsFailure(resp):
+			c.breaker.failure(fmt.Sprintf("status %d", resp.StatusCode))
+		default:
+			c.breaker.success()
+			return resp, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) getOnce(url string) (*Response, error) {
+	response, err := c.http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxResponseBytes))
+	if err != nil {
+		return nil, err
+	}
+	return &Response{StatusCode: response.StatusCode, Body: body}, nil
+}
+
+func (c *Client) Status() Status {
+	status := c.breaker.status()
+	status.Name = c.name
+	return status
+}
+
+// Statuses reports every registered dependency, sorted by name.
+func Statuses() []Status {
+	clientsMu.RLock()
+	statuses := make([]Status, 0, len(clients))
+	for _, c := range clients {
+		statuses = append(statuses, c.Status())
+	}
+	clientsMu.RUnlock()
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// PolicyFromEnv overrides fallback with <prefix>_TIMEOUT, _RETRIES,
+// _BACKOFF, _MAX_BACKOFF, _BREAKER_THRESHOLD and _BREAKER_COOLDOWN.
+func PolicyFromEnv(prefix string, fallback Policy) (Policy, error) {
+	policy := fallback
+	durations := map[string]*time.Duration{
+		"_TIMEOUT":          &policy.Timeout,
+		"_BACKOFF":          &policy.BaseBackoff,
+		"_MAX_BACKOFF":      &policy.MaxBackoff,
+		"_BREAKER_COOLDOWN": &policy.OpenTimeout,
+	}
+	for suffix, target := range durations {
+		if value := os.Getenv(prefix + suffix); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed < 0 {
+				return policy, fmt.Errorf("invalid %s%s %q", prefix, suffix, value)
+			}
+			*target = parsed
+		}
+	}
+	ints := map[string]*int{
+		"_RETRIES":           &policy.MaxRetries,
+		"_BREAKER_THRESHOLD": &policy.FailureThreshold,
+	}
+	for suffix, target := range ints {
+		if value := os.Getenv(prefix + suffix); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				return policy, fmt.Errorf("invalid %s%s %q", prefix, suffix, value)
+			}
+			*target = parsed
+		}
+	}
+	return policy, nil
+}
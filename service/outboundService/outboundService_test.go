@@ -0,0 +1,213 @@
+package outboundService
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stub is an HTTP server whose next responses are scripted: each call takes
+// the first remaining status (or sleeps for delay first), repeating the last
+// one when the script runs out.
+type stub struct {
+	*httptest.Server
+	calls    atomic.Int64
+	statuses []int
+	delay    time.Duration
+}
+
+func newStub(t *testing.T, delay time.Duration, statuses ...int) *stub {
+	s := &stub{statuses: statuses, delay: delay}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := int(s.calls.Add(1)) - 1
+		if s.delay > 0 {
+			time.Sleep(s.delay)
+		}
+		status := s.statuses[len(s.statuses)-1]
+		if call < len(s.statuses) {
+			status = s.statuses[call]
+		}
+		w.WriteHeader(status)
+		w.Write([]byte("body"))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func testPolicy() Policy {
+	return Policy{
+		Timeout:          time.Second,
+		MaxRetries:       2,
+		BaseBackoff:      time.Millisecond,
+		MaxBackoff:       5 * time.Millisecond,
+		FailureThreshold: 3,
+		OpenTimeout:      50 * time.Millisecond,
+	}
+}
+
+func TestGetRetriesServerErrorsUntilRecovery(t *testing.T) {
+	server := newStub(t, 0, http.StatusInternalServerError, http.StatusBadGateway, http.StatusOK)
+	client := New(t.Name(), testPolicy())
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || string(resp.Body) != "body" {
+		t.Fatalf("got %d %q, want 200 \"body\"", resp.StatusCode, resp.Body)
+	}
+	if calls := server.calls.Load(); calls != 3 {
+		t.Fatalf("server saw %d calls, want 3", calls)
+	}
+
+	status := client.Status()
+	if status.State != StateClosed || status.ConsecutiveFailures != 0 || status.Failures != 2 || status.Requests != 3 {
+		t.Fatalf("unexpected status after recovery: %+v", status)
+	}
+}
+
+func TestGetReturnsLastResponseWhenRetriesRunOut(t *testing.T) {
+	server := newStub(t, 0, http.StatusServiceUnavailable)
+	policy := testPolicy()
+	policy.FailureThreshold = 10
+	client := New(t.Name(), policy)
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("got %d, want 503", resp.StatusCode)
+	}
+	if calls := server.calls.Load(); calls != int64(policy.MaxRetries+1) {
+		t.Fatalf("server saw %d calls, want %d", calls, policy.MaxRetries+1)
+	}
+}
+
+func TestGetTimesOut(t *testing.T) {
+	server := newStub(t, 200*time.Millisecond, http.StatusOK)
+	policy := testPolicy()
+	policy.Timeout = 20 * time.Millisecond
+	policy.MaxRetries = 1
+	client := New(t.Name(), policy)
+
+	started := time.Now()
+	if _, err := client.Get(server.URL); err == nil {
+		t.Fatal("Get succeeded, want a timeout error")
+	}
+	if elapsed := time.Since(started); elapsed > 150*time.Millisecond {
+		t.Fatalf("Get took %v, want each attempt cut off after %v", elapsed, policy.Timeout)
+	}
+	if status := client.Status(); status.Failures != 2 || status.LastError == "" {
+		t.Fatalf("unexpected status after timeouts: %+v", status)
+	}
+}
+
+func TestBreakerOpensAndFailsFast(t *testing.T) {
+	server := newStub(t, 0, http.StatusInternalServerError)
+	policy := testPolicy()
+	policy.OpenTimeout = time.Hour
+	client := New(t.Name(), policy)
+
+	// Three failed attempts reach the threshold and open the breaker.
+	if _, err := client.Get(server.URL); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if status := client.Status(); status.State != StateOpen || status.OpenedAt == nil {
+		t.Fatalf("breaker not open after %d failures: %+v", policy.FailureThreshold, status)
+	}
+
+	_, err := client.Get(server.URL)
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got %v, want ErrCircuitOpen", err)
+	}
+	if calls := server.calls.Load(); calls != 3 {
+		t.Fatalf("server saw %d calls, want 3; an open breaker must not call out", calls)
+	}
+	if status := client.Status(); status.Rejected != 1 {
+		t.Fatalf("rejected = %d, want 1", status.Rejected)
+	}
+}
+
+func TestHalfOpenTrialSuccessCloses(t *testing.T) {
+	server := newStub(t, 0, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusOK)
+	policy := testPolicy()
+	client := New(t.Name(), policy)
+
+	client.Get(server.URL)
+	if state := client.Status().State; state != StateOpen {
+		t.Fatalf("state = %s, want open", state)
+	}
+
+	time.Sleep(policy.OpenTimeout)
+	if state := client.Status().State; state != StateHalfOpen {
+		t.Fatalf("state = %s after the cooldown, want half_open", state)
+	}
+
+	resp, err := client.Get(server.URL)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("trial call: %v %v", resp, err)
+	}
+	if status := client.Status(); status.State != StateClosed || status.ConsecutiveFailures != 0 {
+		t.Fatalf("breaker not closed after a successful trial: %+v", status)
+	}
+}
+
+func TestHalfOpenTrialFailureReopens(t *testing.T) {
+	server := newStub(t, 0, http.StatusInternalServerError)
+	policy := testPolicy()
+	client := New(t.Name(), policy)
+
+	client.Get(server.URL)
+	time.Sleep(policy.OpenTimeout)
+
+	// The trial fails and reopens the breaker; the retry that follows is
+	// rejected without reaching the server.
+	resp, err := client.Get(server.URL)
+	if err != nil || resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("trial call: %v %v", resp, err)
+	}
+	if calls := server.calls.Load(); calls != 4 {
+		t.Fatalf("server saw %d calls, want 4", calls)
+	}
+	if status := client.Status(); status.State != StateOpen || status.Rejected != 1 {
+		t.Fatalf("breaker not reopened after a failed trial: %+v", status)
+	}
+}
+
+func TestBackoffStaysUnderCeiling(t *testing.T) {
+	policy := testPolicy()
+	policy.BaseBackoff = 10 * time.Millisecond
+	policy.MaxBackoff = 40 * time.Millisecond
+	client := New(t.Name(), policy)
+
+	for retry := 0; retry < 70; retry++ {
+		ceiling := policy.BaseBackoff << retry
+		if ceiling <= 0 || ceiling > policy.MaxBackoff {
+			ceiling = policy.MaxBackoff
+		}
+		for i := 0; i < 20; i++ {
+			if wait := client.backoff(retry); wait < 0 || wait >= ceiling {
+				t.Fatalf("backoff(%d) = %v, want within [0, %v)", retry, wait, ceiling)
+			}
+		}
+	}
+}
+
+func TestStatusesListsClientsByName(t *testing.T) {
+	New(t.Name()+"/b", DefaultPolicy())
+	New(t.Name()+"/a", DefaultPolicy())
+
+	var names []string
+	for _, status := range Statuses() {
+		if len(status.Name) > len(t.Name()) && status.Name[:len(t.Name())] == t.Name() {
+			names = append(names, status.Name)
+		}
+	}
+	if len(names) != 2 || names[0] != t.Name()+"/a" || names[1] != t.Name()+"/b" {
+		t.Fatalf("Statuses listed %v, want a then b", names)
+	}
+}
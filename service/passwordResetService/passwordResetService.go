@@ -0,0 +1,150 @@
+package passwordResetService
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository/passwordResetRepository"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository/refreshTokenRepository"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository/userRepository"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/apiKeyService"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/mailService"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/sessionService"
+)
+
+const MinPasswordLength = 8
+
+var (
+	tokenLifetime = time.Hour
+	resetURL      = "http://localhost:3000/reset-password"
+	queue         *mailService.Queue
+)
+
+// Configure sets how long reset links stay valid and the frontend page
+// they point to; the token is appended as the "token" query parameter.
+func Configure(lifetime time.Duration, pageURL string) {
+	tokenLifetime = lifetime
+	if pageURL != "" {
+		resetURL = pageURL
+	}
+}
+
+// StartWorkers starts the workers that send queued reset emails, holding at
+// most queueSize requests. They stop once ctx is cancelled and the queue is
+// drained; the returned function waits for that.
+func StartWorkers(ctx context.Context, workers, queueSize int) (wait func()) {
+	queue = mailService.NewQueue("password reset", queueSize)
+	return queue.Start(ctx, workers)
+}
+
+// QueueReset schedules RequestReset for username off the request path. The
+// request is dropped, and logged, when the queue is full.
+func QueueReset(db *sql.DB, username string) error {
+	if queue == nil {
+		return errors.New("password reset workers not started")
+	}
+	return queue.Enqueue(func() error {
+		return RequestReset(db, username)
+	})
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func resetLink(token string) (string, error) {
+	link, err := url.Parse(resetURL)
+	if err != nil {
+		return "", err
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String(), nil
+}
+
+// RequestReset emails a single-use reset link to username. It returns nil
+// for unknown addresses so callers cannot learn which emails are registered.
+func RequestReset(db *sql.DB, username string) error {
+	user, err := userRepository.GetUserByUsername(db, username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	if user.Status == models.StatusInactive {
+		return nil
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	if err := passwordResetRepository.CreateToken(db, user.ID, hashToken(token), time.Now().Add(tokenLifetime)); err != nil {
+		return err
+	}
+
+	link, err := resetLink(token)
+	if err != nil {
+		return err
+	}
+	if err := mailService.SendTemplate(user.Username, "password_reset", map[string]string{
+		"Email":     user.Username,
+		"Link":      link,
+		"ExpiresIn": tokenLifetime.String(),
+	}); err != nil {
+		log.Printf("Error sending password reset email to user %d: %v", user.ID, err)
+		return err
+	}
+	return nil
+}
+
+// ResetPassword consumes token, sets the new password and signs the user
+// out everywhere by revoking all refresh tokens, sessions and API keys.
+func ResetPassword(db *sql.DB, token, newPassword string) error {
+	if len(newPassword) < MinPasswordLength {
+		return models.ErrPasswordTooShort
+	}
+
+	return repository.WithTx(db, func(tx *sql.Tx) error {
+		stored, err := passwordResetRepository.GetTokenByHashForUpdate(tx, hashToken(token))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return models.ErrInvalidResetToken
+			}
+			return err
+		}
+		now := time.Now()
+		if stored.UsedAt != nil || !now.Before(stored.ExpiresAt) {
+			return models.ErrInvalidResetToken
+		}
+
+		if err := userRepository.UpdatePassword(tx, stored.UserID, newPassword); err != nil {
+			return err
+		}
+		if err := passwordResetRepository.MarkUserTokensUsed(tx, stored.UserID, now); err != nil {
+			return err
+		}
+		if err := refreshTokenRepository.RevokeUserTokens(tx, stored.UserID, now); err != nil {
+			return err
+		}
+		if err := sessionService.RevokeAllForUser(tx, stored.UserID); err != nil {
+			return err
+		}
+		return apiKeyService.RevokeAllForUser(tx, stored.UserID)
+	})
+}
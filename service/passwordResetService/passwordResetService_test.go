@@ -0,0 +1,76 @@
+package passwordResetService
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+)
+
+func expectToken(mock sqlmock.Sqlmock, expiresAt time.Time, usedAt interface{}) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM password_reset_tokens WHERE token_hash = ? FOR UPDATE")).
+		WithArgs(hashToken("token")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "expires_at", "used_at"}).
+			AddRow(1, 7, expiresAt, usedAt))
+}
+
+// A reset is the remediation for a compromised account, so it must cut off
+// every credential the attacker could hold: refresh tokens, sessions and
+// API keys.
+func TestResetPasswordRevokesEveryCredential(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	expectToken(mock, time.Now().Add(time.Hour), nil)
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET password = ? WHERE id = ?")).
+		WithArgs(sqlmock.AnyArg(), 7).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE password_reset_tokens SET used_at = ? WHERE user_id = ?")).
+		WithArgs(sqlmock.AnyArg(), 7).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ?")).
+		WithArgs(sqlmock.AnyArg(), 7).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE sessions SET revoked_at = ? WHERE user_id = ?")).
+		WithArgs(sqlmock.AnyArg(), 7).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE api_keys SET revoked_at = ? WHERE user_id = ?")).
+		WithArgs(sqlmock.AnyArg(), 7).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	if err := ResetPassword(db, "token", "new-password"); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResetPasswordRejectsSpentTokens(t *testing.T) {
+	for name, token := range map[string]struct {
+		expiresAt time.Time
+		usedAt    interface{}
+	}{
+		"expired": {time.Now().Add(-time.Minute), nil},
+		"used":    {time.Now().Add(time.Hour), time.Now().Add(-time.Minute)},
+	} {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectToken(mock, token.expiresAt, token.usedAt)
+		mock.ExpectRollback()
+
+		if err := ResetPassword(db, "token", "new-password"); !errors.Is(err, models.ErrInvalidResetToken) {
+			t.Errorf("%s token: ResetPassword = %v, want ErrInvalidResetToken", name, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("%s token: %v", name, err)
+		}
+		db.Close()
+	}
+}
@@ -0,0 +1,30 @@
+package randomService
+
+import (
+	"crypto/rand"
+	"math/big"
+)
+
+// LocalProvider draws characters from the operating system's CSPRNG.
+type LocalProvider struct{}
+
+func (LocalProvider) Name() string {
+	return "local"
+}
+
+func (LocalProvider) Strings(req Request) ([]string, error) {
+	max := big.NewInt(int64(len(req.Alphabet)))
+	values := make([]string, req.Count)
+	for i := range values {
+		chars := make([]rune, req.Length)
+		for j := range chars {
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return nil, err
+			}
+			chars[j] = req.Alphabet[n.Int64()]
+		}
+		values[i] = string(chars)
+	}
+	return values, nil
+}
@@ -0,0 +1,103 @@
+package randomService
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/outboundService"
+)
+
+// Request asks for Count strings of Length characters, each drawn uniformly
+// from Alphabet.
+type Request struct {
+	Length   int
+	Count    int
+	Alphabet []rune
+}
+
+// Size is the number of characters the request draws.
+func (r Request) Size() int {
+	return r.Length * r.Count
+}
+
+// Provider produces random strings. Implementations must be safe for
+// concurrent use.
+type Provider interface {
+	Name() string
+	Strings(req Request) ([]string, error)
+}
+
+// provider is replaced from LoadFromEnv at startup.
+var provider Provider = LocalProvider{}
+
+func SetProvider(p Provider) {
+	provider = p
+}
+
+func Current() Provider {
+	return provider
+}
+
+func Strings(req Request) ([]string, error) {
+	if req.Length < 1 || req.Count < 1 || len(req.Alphabet) == 0 {
+		return nil, errors.New("invalid random string request")
+	}
+	return provider.Strings(req)
+}
+
+// FallbackProvider uses Secondary whenever Primary fails, so an outage or
+// exhausted quota of a remote source does not fail the operation.
+type FallbackProvider struct {
+	Primary   Provider
+	Secondary Provider
+}
+
+func (p *FallbackProvider) Name() string {
+	return p.Primary.Name()
+}
+
+func (p *FallbackProvider) Strings(req Request) ([]string, error) {
+	values, err := p.Primary.Strings(req)
+	if err == nil {
+		return values, nil
+	}
+	log.Printf("Random provider %s failed, falling back to %s: %v", p.Primary.Name(), p.Secondary.Name(), err)
+	return p.Secondary.Strings(req)
+}
+
+// LoadFromEnv builds the provider selected by RANDOM_PROVIDER: "random_org",
+// the default, or "local" (crypto/rand). random.org falls back to the local
+// provider unless RANDOM_FALLBACK=false.
+func LoadFromEnv() (Provider, error) {
+	switch name := os.Getenv("RANDOM_PROVIDER"); name {
+	case "", "random_org":
+		policy, err := outboundService.PolicyFromEnv("RANDOM_ORG", outboundService.DefaultPolicy())
+		if err != nil {
+			return nil, err
+		}
+		remote := NewRandomOrgProvider(policy)
+		if value := os.Getenv("RANDOM_ORG_URL"); value != "" {
+			remote.BaseURL = value
+		}
+
+		fallback := true
+		if value := os.Getenv("RANDOM_FALLBACK"); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid RANDOM_FALLBACK %q", value)
+			}
+			fallback = parsed
+		}
+		if !fallback {
+			return remote, nil
+		}
+		return &FallbackProvider{Primary: remote, Secondary: LocalProvider{}}, nil
+	case "local":
+		return LocalProvider{}, nil
+	default:
+		return nil, fmt.Errorf("unknown RANDOM_PROVIDER %q", name)
+	}
+}
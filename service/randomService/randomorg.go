@@ -0,0 +1,156 @@
+package randomService
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/outboundService"
+)
+
+const (
+	randomOrgURL = "https://www.random.org"
+
+	// randomOrgMaxIntegers is the most integers random.org returns per call.
+	randomOrgMaxIntegers = 10000
+
+	quotaCheckInterval = 10 * time.Minute
+)
+
+var ErrQuotaExceeded = errors.New("random.org quota exceeded")
+
+// RandomOrgProvider draws characters through random.org's integer API, one
+// integer per character indexing into the alphabet, so any alphabet works.
+// The remaining quota is checked at most every quotaCheckInterval and spent
+// locally in between.
+type RandomOrgProvider struct {
+	BaseURL string
+
+	client         *outboundService.Client
+	mu             sync.Mutex
+	quotaBits      float64
+	quotaCheckedAt time.Time
+}
+
+func NewRandomOrgProvider(policy outboundService.Policy) *RandomOrgProvider {
+	client := outboundService.New("random_org", policy)
+	// random.org answers 503 once the quota is spent; retrying that or
+	// opening the breaker over it would not help.
+	client.IsFailure = func(resp *outboundService.Response) bool {
+		return resp.StatusCode >= http.StatusInternalServerError && !isQuotaError(resp)
+	}
+	return &RandomOrgProvider{BaseURL: randomOrgURL, client: client}
+}
+
+func (p *RandomOrgProvider) Name() string {
+	return "random_org"
+}
+
+func isQuotaError(resp *outboundService.Response) bool {
+	return strings.Contains(strings.ToLower(string(resp.Body)), "quota")
+}
+
+func (p *RandomOrgProvider) get(path string, query url.Values) (string, error) {
+	resp, err := p.client.Get(strings.TrimRight(p.BaseURL, "/") + path + "?" + query.Encode())
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		if isQuotaError(resp) {
+			return "", ErrQuotaExceeded
+		}
+		return "", fmt.Errorf("random.org returned %d: %s", resp.StatusCode, strings.TrimSpace(string(resp.Body)))
+	}
+	return string(resp.Body), nil
+}
+
+// reserveQuota refuses requests random.org would reject for lack of quota,
+// refreshing the remaining bits when the last check is stale. The refresh
+// runs without holding the lock so a slow random.org does not stall every
+// concurrent caller behind it.
+func (p *RandomOrgProvider) reserveQuota(bits float64) error {
+	p.mu.Lock()
+	stale := time.Since(p.quotaCheckedAt) > quotaCheckInterval
+	p.mu.Unlock()
+
+	if stale {
+		body, err := p.get("/quota/", url.Values{"format": {"plain"}})
+		if err != nil {
+			return err
+		}
+		remaining, err := strconv.ParseFloat(strings.TrimSpace(body), 64)
+		if err != nil {
+			return fmt.Errorf("unexpected random.org quota %q", body)
+		}
+		p.mu.Lock()
+		p.quotaBits = remaining
+		p.quotaCheckedAt = time.Now()
+		p.mu.Unlock()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.quotaBits < bits {
+		return ErrQuotaExceeded
+	}
+	p.quotaBits -= bits
+	return nil
+}
+
+// releaseQuota returns bits reserved for a request random.org did not serve.
+func (p *RandomOrgProvider) releaseQuota(bits float64) {
+	p.mu.Lock()
+	p.quotaBits += bits
+	p.mu.Unlock()
+}
+
+func (p *RandomOrgProvider) Strings(req Request) ([]string, error) {
+	size := req.Size()
+	if size > randomOrgMaxIntegers {
+		return nil, fmt.Errorf("random.org serves at most %d characters per request", randomOrgMaxIntegers)
+	}
+
+	bits := float64(size) * math.Log2(float64(len(req.Alphabet)))
+	if err := p.reserveQuota(bits); err != nil {
+		return nil, err
+	}
+
+	body, err := p.get("/integers/", url.Values{
+		"num":    {strconv.Itoa(size)},
+		"min":    {"0"},
+		"max":    {strconv.Itoa(len(req.Alphabet) - 1)},
+		"col":    {"1"},
+		"base":   {"10"},
+		"format": {"plain"},
+		"rnd":    {"new"},
+	})
+	if err != nil {
+		p.releaseQuota(bits)
+		return nil, err
+	}
+
+	fields := strings.Fields(body)
+	if len(fields) != size {
+		return nil, fmt.Errorf("random.org returned %d integers, expected %d", len(fields), size)
+	}
+	chars := make([]rune, size)
+	for i, field := range fields {
+		index, err := strconv.Atoi(field)
+		if err != nil || index < 0 || index >= len(req.Alphabet) {
+			return nil, fmt.Errorf("unexpected random.org value %q", field)
+		}
+		chars[i] = req.Alphabet[index]
+	}
+
+	values := make([]string, req.Count)
+	for i := range values {
+		values[i] = string(chars[i*req.Length : (i+1)*req.Length])
+	}
+	return values, nil
+}
@@ -0,0 +1,81 @@
+package randomService
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	mathrand "math/rand/v2"
+)
+
+// Source generates the values of the random operations. A seeded source is
+// the ChaCha8 generator of math/rand/v2 (specified by C2SP chacha8rand)
+// keyed with the SHA-256 of the seed, and every value below is derived from
+// its Uint64 stream by the algorithms documented on each method, so a seed
+// reproduces the same output on every instance and release. An unseeded
+// source is keyed from crypto/rand instead.
+type Source struct {
+	rng *mathrand.ChaCha8
+}
+
+func NewSeededSource(seed string) *Source {
+	return &Source{rng: mathrand.NewChaCha8(sha256.Sum256([]byte(seed)))}
+}
+
+func NewSecureSource() (*Source, error) {
+	var key [32]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return nil, err
+	}
+	return &Source{rng: mathrand.NewChaCha8(key)}, nil
+}
+
+func (s *Source) Uint64() uint64 {
+	return s.rng.Uint64()
+}
+
+// Uint64N returns a value in [0, n) by rejection sampling: draws at or
+// above the largest multiple of n are discarded, the rest taken modulo n.
+func (s *Source) Uint64N(n uint64) uint64 {
+	if n == 0 {
+		return 0
+	}
+	limit := math.MaxUint64 - math.MaxUint64%n
+	for {
+		if v := s.Uint64(); v < limit {
+			return v % n
+		}
+	}
+}
+
+// IntRange returns a value in [min, max]. The full int64 range spans 2^64
+// values, one more than Uint64N can take, and is a single raw draw.
+func (s *Source) IntRange(min, max int64) int64 {
+	span := uint64(max-min) + 1
+	if span == 0 {
+		return int64(s.Uint64())
+	}
+	return min + int64(s.Uint64N(span))
+}
+
+// Float64 returns a value in [0, 1) from the top 53 bits of one draw.
+func (s *Source) Float64() float64 {
+	return float64(s.Uint64()>>11) / (1 << 53)
+}
+
+// Shuffle permutes n elements with Fisher-Yates, swapping element i with
+// Uint64N(i+1) for i from n-1 down to 1.
+func (s *Source) Shuffle(n int, swap func(i, j int)) {
+	for i := n - 1; i > 0; i-- {
+		swap(i, int(s.Uint64N(uint64(i+1))))
+	}
+}
+
+// Read fills p with the little-endian bytes of successive draws.
+func (s *Source) Read(p []byte) {
+	var buf [8]byte
+	for i := 0; i < len(p); i += 8 {
+		binary.LittleEndian.PutUint64(buf[:], s.Uint64())
+		copy(p[i:], buf[:])
+	}
+}
@@ -0,0 +1,83 @@
+package randomService
+
+import (
+	"math"
+	"testing"
+)
+
+// The seeded stream is part of the API: records store seeds so results can
+// be reproduced later, so these values must never change.
+func TestSeededSourceStream(t *testing.T) {
+	src := NewSeededSource("abc")
+	want := []uint64{5941617880298085112, 58750875838832297, 11951654030012456359}
+	for i, w := range want {
+		if got := src.Uint64(); got != w {
+			t.Fatalf("draw %d = %d, want %d", i, got, w)
+		}
+	}
+}
+
+func TestSeededSourcesMatch(t *testing.T) {
+	a, b := NewSeededSource("same"), NewSeededSource("same")
+	other := NewSeededSource("other")
+	differs := false
+	for i := 0; i < 100; i++ {
+		x := a.IntRange(1, 6)
+		if y := b.IntRange(1, 6); x != y {
+			t.Fatalf("draw %d: %d != %d for the same seed", i, x, y)
+		}
+		if other.IntRange(1, 6) != x {
+			differs = true
+		}
+	}
+	if !differs {
+		t.Fatal("different seeds produced the same 100 draws")
+	}
+}
+
+func TestIntRangeStaysInBounds(t *testing.T) {
+	src := NewSeededSource("bounds")
+	for _, r := range []struct{ min, max int64 }{
+		{1, 6},
+		{-5, 5},
+		{7, 7},
+		{math.MinInt64, math.MinInt64 + 1},
+		{math.MaxInt64 - 1, math.MaxInt64},
+		{-1 << 53, 1 << 53},
+	} {
+		for i := 0; i < 1000; i++ {
+			if v := src.IntRange(r.min, r.max); v < r.min || v > r.max {
+				t.Fatalf("IntRange(%d, %d) = %d", r.min, r.max, v)
+			}
+		}
+	}
+}
+
+func TestIntRangeFullInt64Range(t *testing.T) {
+	src := NewSeededSource("abc")
+	first := src.IntRange(math.MinInt64, math.MaxInt64)
+	if first != 5941617880298085112 {
+		t.Fatalf("IntRange over int64 = %d, want the raw draw 5941617880298085112", first)
+	}
+	for i := 0; i < 100; i++ {
+		if src.IntRange(math.MinInt64, math.MaxInt64) != math.MinInt64 {
+			return
+		}
+	}
+	t.Fatal("IntRange over the full int64 range always returned min")
+}
+
+func TestUint64NCoversRange(t *testing.T) {
+	src := NewSeededSource("cover")
+	seen := map[uint64]bool{}
+	for i := 0; i < 1000; i++ {
+		v := src.Uint64N(6)
+		if v >= 6 {
+			t.Fatalf("Uint64N(6) = %d", v)
+		}
+		seen[v] = true
+	}
+	if len(seen) != 6 {
+		t.Fatalf("Uint64N(6) produced only %v in 1000 draws", seen)
+	}
+}
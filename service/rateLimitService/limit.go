@@ -0,0 +1,61 @@
+package rateLimitService
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Requests per Period as a token bucket: up to Requests in a
+// burst, refilled continuously at Requests/Period.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+func (l Limit) ratePerSecond() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Requests, l.Period)
+}
+
+// ParseLimit reads "<requests>/<period>", e.g. "60/1m".
+func ParseLimit(value string) (Limit, error) {
+	requests, period, ok := strings.Cut(strings.TrimSpace(value), "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("rate limit %q must look like 60/1m", value)
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 1 {
+		return Limit{}, fmt.Errorf("rate limit %q must allow at least one request", value)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("rate limit %q has an invalid period", value)
+	}
+	return Limit{Requests: n, Period: d}, nil
+}
+
+// ParseLimits reads a comma-separated list of scope=limit pairs, e.g.
+// "operation=60/1m,operation:random_string=10/1m".
+func ParseLimits(value string) (map[string]Limit, error) {
+	limits := map[string]Limit{}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		scope, limit, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("rate limit %q must look like scope=60/1m", pair)
+		}
+		parsed, err := ParseLimit(limit)
+		if err != nil {
+			return nil, err
+		}
+		limits[strings.TrimSpace(scope)] = parsed
+	}
+	return limits, nil
+}
@@ -0,0 +1,194 @@
+package rateLimitService
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository/rateLimitRepository"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository/userRepository"
+)
+
+// operationScopePrefix marks per-operation-type scopes, which are only
+// limited when configured explicitly and never fall back to the default.
+const operationScopePrefix = "operation:"
+
+// overrideCacheTTL bounds how stale a user's overrides can be on instances
+// other than the one an admin changed them on.
+const overrideCacheTTL = 30 * time.Second
+
+type ErrInvalidOverride string
+
+func (e ErrInvalidOverride) Error() string {
+	return string(e)
+}
+
+var (
+	store        Store = NewMemoryStore()
+	defaultLimit *Limit
+	limits       = map[string]Limit{}
+
+	overridesMu sync.Mutex
+	overrides   = map[int64]cachedOverrides{}
+)
+
+type cachedOverrides struct {
+	byScope map[string]models.RateLimitOverride
+	loaded  time.Time
+}
+
+// Configure sets the bucket store, the limit of route scopes without one of
+// their own (nil for none) and the per-scope limits.
+func Configure(s Store, fallback *Limit, scoped map[string]Limit) {
+	store = s
+	defaultLimit = fallback
+	limits = scoped
+}
+
+func OperationScope(operationType string) string {
+	return operationScopePrefix + operationType
+}
+
+func userOverrides(db *sql.DB, userID int64) (map[string]models.RateLimitOverride, error) {
+	overridesMu.Lock()
+	cached, ok := overrides[userID]
+	overridesMu.Unlock()
+	if ok && time.Since(cached.loaded) < overrideCacheTTL {
+		return cached.byScope, nil
+	}
+
+	rows, err := rateLimitRepository.GetUserOverrides(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	byScope := make(map[string]models.RateLimitOverride, len(rows))
+	for _, row := range rows {
+		byScope[row.Scope] = row
+	}
+
+	overridesMu.Lock()
+	overrides[userID] = cachedOverrides{byScope: byScope, loaded: time.Now()}
+	overridesMu.Unlock()
+	return byScope, nil
+}
+
+func forgetOverrides(userID int64) {
+	overridesMu.Lock()
+	delete(overrides, userID)
+	overridesMu.Unlock()
+}
+
+func evictOverrides(now time.Time) {
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+	for userID, cached := range overrides {
+		if now.Sub(cached.loaded) >= overrideCacheTTL {
+			delete(overrides, userID)
+		}
+	}
+}
+
+// StartSweeper periodically drops buckets that have refilled and cached
+// overrides past their TTL, so neither grows with every client seen.
+func StartSweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			evictOverrides(now)
+			swept, err := store.Sweep(now)
+			if err != nil {
+				log.Printf("Error sweeping rate limit buckets: %v", err)
+				continue
+			}
+			if swept > 0 {
+				log.Printf("Swept %d full rate limit buckets", swept)
+			}
+		}
+	}()
+}
+
+// resolve picks the limit for scope: the user's override, then the scope's
+// configured limit, then the default. It returns nil when unlimited.
+func resolve(db *sql.DB, scope string, userID int64) (*Limit, error) {
+	if userID != 0 {
+		byScope, err := userOverrides(db, userID)
+		if err != nil {
+			return nil, err
+		}
+		if override, ok := byScope[scope]; ok {
+			if override.Requests == 0 {
+				return nil, nil
+			}
+			return &Limit{Requests: override.Requests, Period: time.Duration(override.PeriodSeconds) * time.Second}, nil
+		}
+	}
+	if limit, ok := limits[scope]; ok {
+		return &limit, nil
+	}
+	if strings.HasPrefix(scope, operationScopePrefix) {
+		return nil, nil
+	}
+	return defaultLimit, nil
+}
+
+// Allow counts one request by subject (e.g. "user:42" or "ip:10.0.0.1")
+// against scope. A nil result means the scope is not limited for the caller.
+func Allow(db *sql.DB, scope, subject string, userID int64) (*Result, error) {
+	limit, err := resolve(db, scope, userID)
+	if err != nil || limit == nil {
+		return nil, err
+	}
+	result, err := store.Take(scope+"|"+subject, *limit, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func GetOverrides(db *sql.DB, userID int64) ([]models.RateLimitOverride, error) {
+	return rateLimitRepository.GetUserOverrides(db, userID)
+}
+
+func SetOverride(db *sql.DB, adminID int64, override *models.RateLimitOverride) error {
+	override.Scope = strings.TrimSpace(override.Scope)
+	if override.Scope == "" || len(override.Scope) > 64 {
+		return ErrInvalidOverride("scope is required and must be at most 64 characters")
+	}
+	if override.Requests < 0 {
+		return ErrInvalidOverride("requests must not be negative")
+	}
+	if override.Requests > 0 && override.PeriodSeconds < 1 {
+		return ErrInvalidOverride(fmt.Sprintf("period_seconds must be positive when requests is %d", override.Requests))
+	}
+
+	if _, err := userRepository.GetUserByID(db, override.UserID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrUserNotFound
+		}
+		return err
+	}
+
+	if err := rateLimitRepository.UpsertOverride(db, override, adminID); err != nil {
+		return err
+	}
+	forgetOverrides(override.UserID)
+	return nil
+}
+
+func DeleteOverride(db *sql.DB, userID int64, scope string) error {
+	deleted, err := rateLimitRepository.DeleteOverride(db, userID, scope)
+	if err != nil {
+		return err
+	}
+	forgetOverrides(userID)
+	if !deleted {
+		return models.ErrOverrideNotFound
+	}
+	return nil
+}
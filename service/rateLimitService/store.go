@@ -0,0 +1,133 @@
+package rateLimitService
+
+import (
+	"database/sql"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository/rateLimitRepository"
+)
+
+// Result describes a bucket after a request was counted against it.
+type Result struct {
+	Allowed   bool
+	Limit     Limit
+	Remaining int
+	// Reset is how long until the bucket is full again; RetryAfter is how
+	// long until the next request would be allowed.
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Store holds token buckets. Take must be atomic for a given key. Sweep
+// forgets buckets that have refilled completely, which a missing bucket is
+// taken to be.
+type Store interface {
+	Take(key string, limit Limit, now time.Time) (Result, error)
+	Sweep(now time.Time) (int64, error)
+}
+
+// take refills a bucket holding tokens, last updated at updated, and spends
+// one token if available. A zero updated time means a new, full bucket.
+func take(tokens float64, updated time.Time, limit Limit, now time.Time) (float64, Result) {
+	capacity := float64(limit.Requests)
+	rate := limit.ratePerSecond()
+
+	if updated.IsZero() {
+		tokens = capacity
+	} else if elapsed := now.Sub(updated).Seconds(); elapsed > 0 {
+		tokens = math.Min(capacity, tokens+elapsed*rate)
+	}
+	tokens = math.Min(tokens, capacity)
+
+	result := Result{Limit: limit}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+	}
+	result.Remaining = int(math.Floor(tokens))
+	result.Reset = time.Duration((capacity - tokens) / rate * float64(time.Second))
+	return tokens, result
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+// MemoryStore keeps buckets in process; use it for single instances.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}}
+}
+
+func (s *MemoryStore) Take(key string, limit Limit, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{}
+		s.buckets[key] = b
+	}
+
+	var result Result
+	b.tokens, result = take(b.tokens, b.updated, limit, now)
+	b.updated = now
+	b.full = now.Add(result.Reset)
+	return result, nil
+}
+
+func (s *MemoryStore) Sweep(now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var swept int64
+	for key, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, key)
+			swept++
+		}
+	}
+	return swept, nil
+}
+
+// DatabaseStore keeps buckets in rate_limit_buckets so every instance
+// shares the same limits.
+type DatabaseStore struct {
+	db *sql.DB
+}
+
+func NewDatabaseStore(db *sql.DB) *DatabaseStore {
+	return &DatabaseStore{db: db}
+}
+
+func (s *DatabaseStore) Take(key string, limit Limit, now time.Time) (Result, error) {
+	var result Result
+	err := repository.WithTx(s.db, func(tx *sql.Tx) error {
+		tokens, updatedAtMicros, err := rateLimitRepository.GetBucketForUpdate(tx, key)
+		if err != nil {
+			return err
+		}
+		var updated time.Time
+		if updatedAtMicros != 0 {
+			updated = time.UnixMicro(updatedAtMicros)
+		}
+		tokens, result = take(tokens, updated, limit, now)
+		return rateLimitRepository.SaveBucket(tx, key, tokens, now.UnixMicro(), now.Add(result.Reset).UnixMicro())
+	})
+	return result, err
+}
+
+func (s *DatabaseStore) Sweep(now time.Time) (int64, error) {
+	return rateLimitRepository.DeleteFullBuckets(s.db, now.UnixMicro())
+}
@@ -7,7 +7,7 @@ import (
 	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository/recordRepository"
 )
 
-func CreateRecord(db *sql.DB, operationID int64, userID int64, amount float64, userBalance float64, operationResponse string) error {
+func CreateRecord(db *sql.DB, operationID int64, userID int64, amount models.Money, userBalance models.Money, operationResponse string) (int64, error) {
 	return recordRepository.CreateRecord(db, operationID, userID, amount, userBalance, operationResponse)
 }
 
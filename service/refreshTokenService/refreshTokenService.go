@@ -0,0 +1,139 @@
+package refreshTokenService
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository/refreshTokenRepository"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/sessionService"
+)
+
+func randomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken is what gets stored, so a leaked table cannot be replayed.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issue adds a token to the session's family. Its own expiry is the session's
+// absolute maximum; the sliding idle timeout is enforced on the session.
+func issue(db repository.Executor, session *models.Session) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	if err := refreshTokenRepository.CreateToken(db, session.UserID, session.ID, hashToken(token), session.AbsoluteExpiresAt); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Issue starts a new session and token family, typically at login.
+func Issue(db *sql.DB, userID int64) (string, *models.Session, error) {
+	var token string
+	var session *models.Session
+	err := repository.WithTx(db, func(tx *sql.Tx) error {
+		var err error
+		session, err = sessionService.Start(tx, userID)
+		if err != nil {
+			return err
+		}
+		token, err = issue(tx, session)
+		return err
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return token, session, nil
+}
+
+// Rotate exchanges a refresh token for a new one in the same family and
+// extends the session. A token that was already rotated means it leaked, so
+// the whole family and its session are revoked.
+func Rotate(db *sql.DB, token string) (*models.Session, string, error) {
+	var session *models.Session
+	var newToken string
+	reused := false
+
+	err := repository.WithTx(db, func(tx *sql.Tx) error {
+		stored, err := refreshTokenRepository.GetTokenByHashForUpdate(tx, hashToken(token))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return models.ErrInvalidRefreshToken
+			}
+			return err
+		}
+		if stored.RevokedAt != nil || stored.ExpiresAt.Before(time.Now()) {
+			return models.ErrInvalidRefreshToken
+		}
+		if stored.RotatedAt != nil {
+			reused = true
+			if err := refreshTokenRepository.RevokeFamily(tx, stored.FamilyID, time.Now()); err != nil {
+				return err
+			}
+			return sessionService.Revoke(tx, stored.FamilyID)
+		}
+
+		session, err = sessionService.Extend(tx, stored.FamilyID)
+		if err != nil {
+			if errors.Is(err, models.ErrSessionExpired) {
+				return models.ErrInvalidRefreshToken
+			}
+			return err
+		}
+
+		if err := refreshTokenRepository.MarkRotated(tx, stored.ID, time.Now()); err != nil {
+			return err
+		}
+		newToken, err = issue(tx, session)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if reused {
+		return nil, "", models.ErrRefreshTokenReused
+	}
+	return session, newToken, nil
+}
+
+// Revoke invalidates every token in the presented token's family and ends
+// its session.
+func Revoke(db *sql.DB, token string) error {
+	familyID, err := refreshTokenRepository.GetFamilyByHash(db, hashToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrInvalidRefreshToken
+		}
+		return err
+	}
+	return repository.WithTx(db, func(tx *sql.Tx) error {
+		if err := refreshTokenRepository.RevokeFamily(tx, familyID, time.Now()); err != nil {
+			return err
+		}
+		return sessionService.Revoke(tx, familyID)
+	})
+}
+
+func RevokeAllForUser(db *sql.DB, userID int64) error {
+	return repository.WithTx(db, func(tx *sql.Tx) error {
+		if err := refreshTokenRepository.RevokeUserTokens(tx, userID, time.Now()); err != nil {
+			return err
+		}
+		return sessionService.RevokeAllForUser(tx, userID)
+	})
+}
@@ -0,0 +1,127 @@
+package sessionService
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository/sessionRepository"
+)
+
+// touchInterval bounds how often activity is written for one session.
+const touchInterval = time.Minute
+
+var (
+	idleTimeout = 30 * time.Minute
+	maxLifetime = 24 * time.Hour
+)
+
+// SetLifetimes configures how long a session survives without activity and
+// the absolute maximum it can last however active the user is.
+func SetLifetimes(idle, absolute time.Duration) {
+	idleTimeout = idle
+	maxLifetime = absolute
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func Start(db repository.Executor, userID int64) (*models.Session, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := &models.Session{
+		ID:                id,
+		UserID:            userID,
+		CreatedAt:         now,
+		LastActivityAt:    now,
+		IdleExpiresAt:     minTime(now.Add(idleTimeout), now.Add(maxLifetime)),
+		AbsoluteExpiresAt: now.Add(maxLifetime),
+	}
+	if err := sessionRepository.CreateSession(db, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func Check(session *models.Session, now time.Time) error {
+	if session.RevokedAt != nil || !now.Before(session.IdleExpiresAt) || !now.Before(session.AbsoluteExpiresAt) {
+		return models.ErrSessionExpired
+	}
+	return nil
+}
+
+func Get(db repository.Executor, sessionID string) (*models.Session, error) {
+	session, err := sessionRepository.GetSession(db, sessionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrSessionExpired
+		}
+		return nil, err
+	}
+	return session, nil
+}
+
+// Extend slides the idle expiry of an active session and returns the
+// updated session.
+func Extend(db repository.Executor, sessionID string) (*models.Session, error) {
+	session, err := Get(db, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if err := Check(session, now); err != nil {
+		return nil, err
+	}
+
+	if err := sessionRepository.Touch(db, sessionID, now, now.Add(idleTimeout), now.Add(1*time.Second)); err != nil {
+		return nil, err
+	}
+	session.LastActivityAt = now
+	session.IdleExpiresAt = minTime(now.Add(idleTimeout), session.AbsoluteExpiresAt)
+	return session, nil
+}
+
+// Touch validates the session behind an access token and records activity
+// at most once per touchInterval.
+func Touch(db *sql.DB, sessionID string) error {
+	session, err := Get(db, sessionID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := Check(session, now); err != nil {
+		return err
+	}
+	if now.Sub(session.LastActivityAt) < touchInterval {
+		return nil
+	}
+	return sessionRepository.Touch(db, sessionID, now, now.Add(idleTimeout), now.Add(-touchInterval))
+}
+
+func Revoke(db repository.Executor, sessionID string) error {
+	return sessionRepository.RevokeSession(db, sessionID, time.Now())
+}
+
+func RevokeAllForUser(db repository.Executor, userID int64) error {
+	return sessionRepository.RevokeUserSessions(db, userID, time.Now())
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
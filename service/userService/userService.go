@@ -3,19 +3,22 @@ package userService
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 
 	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository"
 	"github.com/Ignacio-J-Maylin/arithmetic-calculator/repository/userRepository"
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/service/ledgerService"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func RegisterUser(db *sql.DB, username, password string) error {
+func RegisterUser(db *sql.DB, username, password string) (int64, error) {
 	_, err := userRepository.GetUserByUsername(db, username)
 	if err == nil {
-		return errors.New("user already exists")
+		return 0, errors.New("user already exists")
 	}
 	if !errors.Is(err, sql.ErrNoRows) {
-		return err
+		return 0, err
 	}
 
 	return userRepository.CreateUser(db, username, password)
@@ -35,29 +38,143 @@ func AuthenticateUser(db *sql.DB, username, password string) (int64, bool, error
 		return 0, false, nil
 	}
 
+	if !user.CanAuthenticate() {
+		return 0, false, models.ErrAccountDisabled
+	}
+
 	return user.ID, true, nil
 }
 
-func AddCreditsToUser(db *sql.DB, userID int64, credits float64) error {
+func AddCreditsToUser(db *sql.DB, userID int64, credits models.Money) error {
 	if credits <= 0 {
-		return errors.New("credits must be greater than zero")
+		return models.ErrInvalidAmount
 	}
 
-	return userRepository.AddCredits(db, userID, credits)
+	_, err := ledgerService.Post(db, ledgerService.Posting{
+		UserID: userID,
+		Type:   models.LedgerTopUp,
+		Amount: credits,
+		Reason: "Credit top-up",
+	})
+	return err
 }
 
-func RemoveCreditsFromUser(db *sql.DB, userID int64, credits float64) error {
+func RemoveCreditsFromUser(db *sql.DB, userID int64, credits models.Money) error {
 	if credits <= 0 {
-		return errors.New("credits to remove must be greater than zero")
+		return models.ErrInvalidAmount
+	}
+
+	_, err := ledgerService.Post(db, ledgerService.Posting{
+		UserID: userID,
+		Type:   models.LedgerAdjustment,
+		Amount: -credits,
+		Reason: "Credits removed by user",
+	})
+	return err
+}
+
+// GetUserCredits derives the balance from the ledger, which is the source
+// of truth; balances.credits is only a cache of the latest running balance.
+func GetUserCredits(db *sql.DB, userID int64) (models.Money, error) {
+	if _, err := userRepository.GetCredits(db, userID); err != nil {
+		return 0, err
+	}
+	return ledgerService.Balance(db, userID)
+}
+
+// GetHeldCredits returns the part of the balance reserved by queued jobs.
+func GetHeldCredits(db *sql.DB, userID int64) (models.Money, error) {
+	return userRepository.GetHeldCredits(db, userID)
+}
+
+func GetUserRoles(db *sql.DB, userID int64) ([]string, error) {
+	return userRepository.GetUserRoles(db, userID)
+}
+
+// SetUserRoles replaces every role of the user. Every user keeps the base
+// "user" role so they can still use the calculator.
+func SetUserRoles(db *sql.DB, userID int64, roles []string) ([]string, error) {
+	for _, role := range roles {
+		if !models.IsValidRole(role) {
+			return nil, fmt.Errorf("invalid role %q", role)
+		}
+	}
+	if !models.HasRole(roles, models.RoleUser) {
+		roles = append(roles, models.RoleUser)
+	}
+
+	if _, err := userRepository.GetUserByID(db, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	err := repository.WithTx(db, func(tx *sql.Tx) error {
+		if err := userRepository.DeleteUserRoles(tx, userID); err != nil {
+			return err
+		}
+		for _, role := range roles {
+			if err := userRepository.AddUserRole(tx, userID, role); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return userRepository.GetUserRoles(db, userID)
+}
 
-	return userRepository.RemoveCredits(db, userID, credits)
+// BootstrapAdmin grants the admin role to an existing user so a fresh
+// deployment has someone able to manage roles.
+func BootstrapAdmin(db *sql.DB, username string) error {
+	user, err := userRepository.GetUserByUsername(db, username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("bootstrap admin %q does not exist", username)
+		}
+		return err
+	}
+	return userRepository.AddUserRole(db, user.ID, models.RoleAdmin)
 }
 
-func GetUserCredits(db *sql.DB, userID int64) (float64, error) {
-	return userRepository.GetCredits(db, userID)
+func GrantCredits(db *sql.DB, adminID, userID int64, credits models.Money, reason string) (*models.LedgerEntry, error) {
+	if credits == 0 {
+		return nil, errors.New("credits must not be zero")
+	}
+	if reason == "" {
+		reason = "Credits granted by admin"
+	}
+
+	if _, err := userRepository.GetUserByID(db, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	entryType := models.LedgerTopUp
+	if credits < 0 {
+		entryType = models.LedgerAdjustment
+	}
+	return ledgerService.Post(db, ledgerService.Posting{
+		UserID:  userID,
+		Type:    entryType,
+		Amount:  credits,
+		Reason:  reason,
+		AdminID: &adminID,
+	})
 }
 
-func GetAllOperations(db *sql.DB) ([]models.Operation, error) {
-	return userRepository.GetAllOperations(db)
+func GetUserByID(db *sql.DB, userID int64) (*models.User, error) {
+	user, err := userRepository.GetUserByID(db, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrUserNotFound
+		}
+		return nil, err
+	}
+	return user, nil
 }
@@ -0,0 +1,19 @@
+package userService
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Ignacio-J-Maylin/arithmetic-calculator/models"
+)
+
+func TestCreditChangesRejectNonPositiveAmounts(t *testing.T) {
+	for _, credits := range []models.Money{0, -1, -models.MoneyScale} {
+		if err := AddCreditsToUser(nil, 1, credits); !errors.Is(err, models.ErrInvalidAmount) {
+			t.Errorf("AddCreditsToUser(%s) = %v, want ErrInvalidAmount", credits, err)
+		}
+		if err := RemoveCreditsFromUser(nil, 1, credits); !errors.Is(err, models.ErrInvalidAmount) {
+			t.Errorf("RemoveCreditsFromUser(%s) = %v, want ErrInvalidAmount", credits, err)
+		}
+	}
+}